@@ -32,7 +32,22 @@ func Execute() error {
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "enable debug logging for troubleshooting sake")
 	viper.BindPFlag("verbose", rootCmd.PersistentFlags().Lookup("verbose"))
 
+	daemonCmd.Flags().String("pidfile", "", "write the process ID to this file while running")
+	installServiceCmd.Flags().Bool("force", false, "replace the unit if it already exists")
+
+	loginCmd.Flags().String("account", "", "only use the API key for replays of this AccountID (the folder under Accounts)")
+	loginCmd.Flags().Bool("browser", false, "login using a headless browser (Chromium) instead of plain requests")
+	viper.BindPFlag("login.browser", loginCmd.Flags().Lookup("browser"))
+
+	uploadCmd.Flags().Bool("dry-run", false, "only explain which replays would be uploaded, and why")
+	uploadCmd.Flags().Bool("force", false, "upload replays even if they were already uploaded before")
+	uploadCmd.Flags().String("since", "", "only upload replays played on or after this date (YYYY-MM-DD)")
+	uploadCmd.Flags().String("until", "", "only upload replays played on or before this date (YYYY-MM-DD)")
+	uploadCmd.Flags().StringSlice("toon", nil, "only upload replays of these toons (ToonID or AccountID/ToonID)")
+
 	// Add Commands
+	daemonCmd.AddCommand(installServiceCmd)
+	rootCmd.AddCommand(daemonCmd)
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(updateCmd)
 	rootCmd.AddCommand(uploadCmd)
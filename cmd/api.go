@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kataras/golog"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+// newAPIClient returns an sc2replaystats client using the given API key, set
+// up as described by the "api" section of the configuration
+func newAPIClient(key string) *sc2replaystats.Client {
+	return sc2replaystats.New(key, apiOptions()...)
+}
+
+// replayURL returns the address of a replay's page on the Website, even when
+// there is no default API key
+func replayURL(replayID string) string {
+	if sc2api != nil {
+		return sc2api.ReplayURL(replayID)
+	}
+
+	return newAPIClient("").ReplayURL(replayID)
+}
+
+// apiOptions returns the sc2replaystats client options described by the
+// "api" section of the configuration
+func apiOptions() []sc2replaystats.Option {
+	return []sc2replaystats.Option{
+		sc2replaystats.WithAPIRoot(viper.GetString("api.url")),
+		sc2replaystats.WithWebRoot(viper.GetString("api.webUrl")),
+		sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{
+			Attempts: viper.GetInt("api.retry.attempts"),
+			Delay:    viper.GetDuration("api.retry.delay"),
+			MaxDelay: viper.GetDuration("api.retry.maxDelay"),
+		}),
+		sc2replaystats.WithTimeouts(sc2replaystats.Timeouts{
+			Upload:  viper.GetDuration("api.timeout.upload"),
+			Status:  viper.GetDuration("api.timeout.status"),
+			Account: viper.GetDuration("api.timeout.account"),
+		}),
+	}
+}
+
+// newAPIClients returns the client for the configured API key, or nil if
+// there is none but some accounts were given their own key, and a client for
+// each account given its own key, by AccountID
+func newAPIClients() (*sc2replaystats.Client, map[string]*sc2replaystats.Client, error) {
+	accountKeys, err := getAccountAPIKeys()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	clients := make(map[string]*sc2replaystats.Client)
+	for acc, key := range accountKeys {
+		clients[acc] = newAPIClient(key)
+	}
+
+	key, err := getAPIKey()
+	if err != nil {
+		if len(clients) == 0 || viper.GetString("apikey") != "" {
+			return nil, nil, err
+		}
+
+		return nil, clients, nil
+	}
+
+	return newAPIClient(key), clients, nil
+}
+
+// verifyAPIClient checks that sc2replaystats accepts the API key of client,
+// returning an error if it does not; keys which could not be checked, such
+// as while offline, are let through with a warning
+func verifyAPIClient(client *sc2replaystats.Client) error {
+	err := client.VerifyKey()
+	if errors.Is(err, sc2replaystats.ErrKeyUnverified) {
+		golog.Warnf("%v, continuing anyway", err)
+		return nil
+	}
+
+	return err
+}
+
+// maskAPIKey returns enough of an API key for telling it apart from others,
+// without showing all of it
+func maskAPIKey(key string) string {
+	if len(key) < 8 {
+		return "none"
+	}
+
+	return fmt.Sprintf("%s…%s", key[:4], key[len(key)-4:])
+}
+
+// describeAPIError returns a message for showing err to the user, with advice
+// on what to do about it where there is any
+func describeAPIError(err error) string {
+	var limited *sc2replaystats.ErrRateLimited
+
+	switch {
+	case errors.Is(err, sc2replaystats.ErrKeyInvalid), errors.Is(err, sc2replaystats.ErrUnauthorized):
+		return "sc2replaystats did not accept your API key (it may be mistyped, expired or revoked), please login again"
+	case errors.As(err, &limited):
+		return "sc2replaystats is receiving too many requests, please try again later"
+	}
+
+	return err.Error()
+}
@@ -6,12 +6,15 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/kataras/golog"
 	"github.com/spf13/viper"
 
 	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
 )
 
 var (
@@ -19,6 +22,21 @@ var (
 	cfgFile        string
 	defaultCfgFile string
 	defaults       = map[string]interface{}{
+		"api.retry.attempts":       sc2replaystats.DefaultRetryPolicy.Attempts,
+		"api.retry.delay":          sc2replaystats.DefaultRetryPolicy.Delay.String(),
+		"api.retry.maxDelay":       sc2replaystats.DefaultRetryPolicy.MaxDelay.String(),
+		"api.timeout.account":      sc2replaystats.DefaultTimeouts.Account.String(),
+		"api.timeout.status":       sc2replaystats.DefaultTimeouts.Status.String(),
+		"api.timeout.upload":       sc2replaystats.DefaultTimeouts.Upload.String(),
+		"api.url":                  sc2replaystats.DefaultAPIRoot,
+		"api.webUrl":               sc2replaystats.DefaultWebRoot,
+		"catchUp.lookback":         "72h",
+		"metrics.address":          "localhost:8766",
+		"metrics.enabled":          false,
+		"replayCategories":         []string{sc2utils.DefaultCategory},
+		"secrets.backend":          "auto",
+		"status.address":           "localhost:8765",
+		"status.enabled":           false,
 		"theme.iconInlineSize":     20, // 20
 		"theme.padding":            4,
 		"theme.scrollBarSize":      12, // 16
@@ -27,6 +45,11 @@ var (
 		"update.automatic.enabled": false,
 		"update.check.enabled":     true,
 		"update.check.period":      time.Duration(minimumUpdatePeriod).String(),
+		"upload.maxPolling":        uploader.DefaultMaxPolling.String(),
+		"upload.workers":           uploader.DefaultWorkers,
+		"upload.writeTimeout":      uploader.DefaultWriteTimeout.String(),
+		"watcher.mode":             "auto",
+		"watcher.pollInterval":     "2s",
 	}
 )
 
@@ -78,6 +101,8 @@ func loadConfig() {
 	if viper.GetBool("verbose") {
 		golog.SetLevel("debug")
 	}
+
+	loadSecrets()
 }
 
 func saveConfig() error {
@@ -89,7 +114,18 @@ func saveConfig() error {
 		cfgFile = defaultCfgFile
 	}
 
-	if err := viper.WriteConfigAs(cfgFile); err != nil {
+	// secrets are written to the secret store instead, where there is one
+	settings := viper.AllSettings()
+	if err := saveSecrets(settings); err != nil {
+		golog.Warnf("API keys are saved in the configuration file: %v", err)
+	}
+
+	v := viper.New()
+	for key, val := range settings {
+		v.Set(key, val)
+	}
+
+	if err := v.WriteConfigAs(cfgFile); err != nil {
 		return fmt.Errorf("unable to save configuration: %v", err)
 	}
 
@@ -98,6 +134,71 @@ func saveConfig() error {
 	return nil
 }
 
+// getAPIKey returns the configured API key, or an error explaining why it
+// cannot be used to communicate with sc2replaystats
+func getAPIKey() (string, error) {
+	key := viper.GetString("apikey")
+	if key == "" {
+		return "", errors.New("no API key in configuration, please use the login command")
+	}
+
+	if !sc2replaystats.ValidAPIKey(key) {
+		return "", errors.New("invalid API key in configuration, please replace it or use the login command")
+	}
+
+	return key, nil
+}
+
+// getAccountAPIKeys returns the API keys given to individual accounts under
+// "accountKeys" in the configuration, by AccountID, or an error naming the
+// first account whose key cannot be used
+func getAccountAPIKeys() (map[string]string, error) {
+	keys := viper.GetStringMapString("accountKeys")
+
+	for acc, key := range keys {
+		if !sc2replaystats.ValidAPIKey(key) {
+			return nil, fmt.Errorf("invalid API key for account %s in configuration, please replace it or use the login command", acc)
+		}
+	}
+
+	return keys, nil
+}
+
+// getAccountAPIKey returns the API key replays of an account are uploaded
+// with, and whether the account was given its own key instead of "apikey"
+func getAccountAPIKey(accountID string) (key string, own bool) {
+	if key = viper.GetStringMapString("accountKeys")[accountID]; key != "" {
+		return key, true
+	}
+
+	return viper.GetString("apikey"), false
+}
+
+// setAccountAPIKey gives an account its own API key, used for uploading its
+// replays instead of "apikey"
+func setAccountAPIKey(accountID, key string) error {
+	if !sc2replaystats.ValidAPIKey(key) {
+		return errors.New("invalid API key format")
+	}
+
+	keys := viper.GetStringMapString("accountKeys")
+	if keys[accountID] == key {
+		golog.Infof("API key of account %s already in configuration! Doing nothing.", accountID)
+		return nil
+	}
+
+	keys[accountID] = key
+	viper.Set("accountKeys", keys)
+
+	if err := saveConfig(); err != nil {
+		return err
+	}
+
+	golog.Infof("API Key of account %s set in configuration!", accountID)
+
+	return nil
+}
+
 func setAPIkey(key string) error {
 	if !sc2replaystats.ValidAPIKey(key) {
 		return errors.New("invalid API key format")
@@ -176,3 +277,36 @@ func setToons(toons []string) error {
 
 	return saveConfig()
 }
+
+// getToonCategories returns the replay categories (the folders under
+// "Replays", such as "Multiplayer") watched for a toon, which are those of
+// "replayCategories" unless configured for the toon in "toonCategories"
+func getToonCategories(toon string) []string {
+	toon = filepath.ToSlash(toon)
+
+	// viper lowercases keys, so "1-S2-1-..." is read back as "1-s2-1-..."
+	for id, categories := range viper.GetStringMapStringSlice("toonCategories") {
+		if strings.EqualFold(id, toon) {
+			return categories
+		}
+	}
+
+	return viper.GetStringSlice("replayCategories")
+}
+
+// setToonCategories changes the replay categories watched for a toon
+func setToonCategories(toon string, categories []string) error {
+	toon = filepath.ToSlash(toon)
+	all := viper.GetStringMapStringSlice("toonCategories")
+
+	for id := range all {
+		if strings.EqualFold(id, toon) {
+			delete(all, id)
+		}
+	}
+
+	all[toon] = categories
+	viper.Set("toonCategories", all)
+
+	return saveConfig()
+}
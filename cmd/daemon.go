@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/kataras/golog"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/systemd"
+	"github.com/AlbinoGeek/sc2-rsu/utils"
+)
+
+// serviceUnit is the systemd user unit written by install-service
+var serviceUnit = template.Must(template.New("unit").Parse(`[Unit]
+Description=SC2ReplayStats Uploader
+After=network-online.target
+
+[Service]
+Type=notify
+NotifyAccess=main
+ExecStart={{.ExecStart}}
+ExecReload=/bin/kill -HUP $MAINPID
+PIDFile=%t/{{.Program}}.pid
+Restart=on-failure
+WatchdogSec=60
+
+[Install]
+WantedBy=default.target
+`))
+
+var daemonCmd = &cobra.Command{
+	Use:     "daemon",
+	Aliases: []string{"serve"},
+	Short:   "Upload new replays in the background, such as a systemd service",
+	Long: `Upload new replays in the background, such as a systemd service
+
+Runs without any user interface, uploading new replays as text mode does.
+When run by systemd (Type=notify), it reports when it is ready and keeps
+the watchdog fed. SIGHUP reloads the configuration and rescans the replay
+directories for accounts, keeping the previous configuration if the new one
+does not work; SIGINT or SIGTERM stop it once uploads in-flight have been
+cancelled (they are resumed on the next start).
+
+See "install-service" to have it started when logging in.`,
+	Example: `  daemon --pidfile /run/user/1000/sc2-rsu.pid
+  daemon install-service`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// the journal already records when each line was logged
+		if os.Getenv("JOURNAL_STREAM") != "" {
+			golog.SetTimeFormat("")
+		}
+
+		if pidfile, _ := cmd.Flags().GetString("pidfile"); pidfile != "" {
+			remove, err := utils.WritePidFile(pidfile)
+			if err != nil {
+				return err
+			}
+			defer remove()
+		}
+
+		svc, err := startUploadService(false)
+		if err != nil {
+			return err
+		}
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+
+		// fed apart from handling signals, as reloading may take a while
+		if interval, err := systemd.WatchdogInterval(); err != nil {
+			golog.Warn(err)
+		} else if interval > 0 {
+			stop := feedWatchdog(interval / 2)
+			defer stop()
+		}
+
+		golog.Debugf("Startup took: %v", time.Since(startTime))
+		golog.Info("Ready!")
+		notify(systemd.Ready, svc.status())
+
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				golog.Info("Reloading configuration...")
+				notify(systemd.Reloading)
+
+				if err := svc.reload(); err != nil {
+					golog.Errorf("keeping previous configuration: %v", err)
+				}
+
+				notify(systemd.Ready, svc.status())
+				continue
+			}
+
+			golog.Warnf("Received signal:%v, Quitting.", sig)
+			notify(systemd.Stopping)
+			cancelUploads()
+			svc.stop()
+
+			return nil
+		}
+
+		return nil
+	},
+}
+
+var installServiceCmd = &cobra.Command{
+	Use:   "install-service",
+	Args:  cobra.NoArgs,
+	Short: "Writes a systemd user unit running the daemon",
+	Long: `Writes a systemd user unit running the daemon
+
+The unit is written to ~/.config/systemd/user (or $XDG_CONFIG_HOME), using
+the configuration file in use now, and is not enabled until asked to be.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate program: %v", err)
+		}
+
+		if exe, err = filepath.EvalSymlinks(exe); err != nil {
+			return fmt.Errorf("failed to locate program: %v", err)
+		}
+
+		execStart := fmt.Sprintf("%s daemon", systemd.Quote(exe))
+		if cfg := viper.ConfigFileUsed(); cfg != "" {
+			if abs, err := filepath.Abs(cfg); err == nil {
+				cfg = abs
+			}
+
+			execStart += fmt.Sprintf(" --config %s", systemd.Quote(cfg))
+		}
+
+		execStart += fmt.Sprintf(" --pidfile %%t/%s.pid", PROGRAM)
+
+		dir := os.Getenv("XDG_CONFIG_HOME")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return err
+			}
+
+			dir = filepath.Join(home, ".config")
+		}
+
+		dir = filepath.Join(dir, "systemd", "user")
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %v: %v", dir, err)
+		}
+
+		name := filepath.Join(dir, fmt.Sprintf("%s.service", PROGRAM))
+		if _, err = os.Stat(name); err == nil && !force {
+			return fmt.Errorf("%v already exists, use --force to replace it", name)
+		}
+
+		f, err := os.Create(name)
+		if err != nil {
+			return fmt.Errorf("failed to write unit: %v", err)
+		}
+
+		err = serviceUnit.Execute(f, map[string]string{
+			"ExecStart": execStart,
+			"Program":   PROGRAM,
+		})
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to write unit: %v", err)
+		}
+
+		golog.Infof("Wrote systemd unit: %v", name)
+		fmt.Printf("\nTo start it now, and whenever you log in:\n\n  systemctl --user daemon-reload\n  systemctl --user enable --now %s.service\n\n", PROGRAM)
+
+		return nil
+	},
+}
+
+// feedWatchdog notifies systemd's watchdog every interval until stopped
+func feedWatchdog(interval time.Duration) (stop func()) {
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-t.C:
+				notify(systemd.Watchdog)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		t.Stop()
+		close(done)
+	}
+}
+
+// notify tells systemd about the daemon's state, when run by systemd
+func notify(states ...string) {
+	if _, err := systemd.Notify(states...); err != nil {
+		golog.Warn(err)
+	}
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/kataras/golog"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+)
+
+// replayLedger records every replay we upload, see openLedger
+var replayLedger *ledger.Ledger
+
+// getLedgerPath returns where the upload ledger is stored, which is next to
+// the configuration file unless "ledger.path" is configured
+func getLedgerPath() string {
+	if p := viper.GetString("ledger.path"); p != "" {
+		return p
+	}
+
+	dir := "."
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		dir = filepath.Dir(cfg)
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s.db", PROGRAM))
+}
+
+func openLedger() error {
+	if replayLedger != nil {
+		return nil
+	}
+
+	l, err := ledger.Open(getLedgerPath())
+	if errors.Is(err, ledger.ErrLocked) {
+		return fmt.Errorf("%s is already running, please close it first, or let it upload the replays: %w", PROGRAM, err)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	golog.Debugf("using ledger: %v", getLedgerPath())
+	replayLedger = l
+
+	return nil
+}
+
+func closeLedger() {
+	if replayLedger == nil {
+		return
+	}
+
+	if err := replayLedger.Close(); err != nil {
+		golog.Warnf("failed to close ledger: %v", err)
+	}
+
+	replayLedger = nil
+}
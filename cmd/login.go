@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -12,6 +14,7 @@ import (
 	"github.com/mitchellh/go-wordwrap"
 	"github.com/mxschmitt/playwright-go"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
 )
@@ -40,9 +43,21 @@ var (
 		},
 		Short: "Add an sc2replaystats account to the config file",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// is the key for a single account only?
+			saveKey := setAPIkey
+			if account, _ := cmd.Flags().GetString("account"); account != "" {
+				saveKey = func(key string) error {
+					return setAccountAPIKey(account, key)
+				}
+			}
+
 			// is it an API key?
 			if sc2replaystats.ValidAPIKey(args[0]) {
-				return setAPIkey(args[0])
+				if err := verifyAPIClient(newAPIClient(args[0])); err != nil {
+					return fmt.Errorf("API key not saved: %v", describeAPIError(err))
+				}
+
+				return saveKey(args[0])
 			}
 
 			// is it an email address?
@@ -59,38 +74,20 @@ var (
 				return fmt.Errorf("failed to prompt user for password: %v", err)
 			}
 
-			golog.Debug("Setting up browser...")
 			t := time.Now()
-			pw, browser, page, err := newBrowser()
-			if pw != nil {
-				defer pw.Stop()
-			}
-			if browser != nil {
-				defer browser.Close()
-			}
-			if page != nil {
-				defer page.Close()
-			}
+			accid, key, err := obtainAPIKey(args[0], password)
 			if err != nil {
-				return fmt.Errorf("failed to setup browser: %v", err)
+				return err
 			}
-			golog.Debugf("browser setup took %s", time.Since(t))
 
-			t = time.Now()
-			accid, err := login(page, args[0], password)
-			if err != nil {
-				return fmt.Errorf("email login error: %v", err)
-			}
 			golog.Debugf("login took %s", time.Since(t))
 			golog.Infof("Success! Logged in to account #%v", accid)
 
-			t = time.Now()
-			key, err := extractAPIKey(page, accid)
-			if err != nil {
-				return fmt.Errorf("extractAPIKey error: %v", err)
+			if err = verifyAPIClient(newAPIClient(key)); err != nil {
+				return fmt.Errorf("API key not saved: %v", describeAPIError(err))
 			}
-			golog.Debugf("extractAPIKey took %s", time.Since(t))
-			if err = setAPIkey(key); err != nil {
+
+			if err = saveKey(key); err != nil {
 				return fmt.Errorf("setAPIKey: %v", err)
 			}
 			return nil
@@ -98,8 +95,73 @@ var (
 	}
 )
 
+// obtainAPIKey logs in to sc2replaystats with an email address and password,
+// returning the account's ID and API key; a browser is only used if the
+// Website did not look as expected without one, or "login.browser" is set
+func obtainAPIKey(email, password string) (accountID, key string, err error) {
+	if !viper.GetBool("login.browser") {
+		if accountID, key, err = sessionAPIKey(email, password); !errors.Is(err, sc2replaystats.ErrUnexpectedPage) {
+			return
+		}
+
+		golog.Warnf("%v, trying again using a browser", err)
+	}
+
+	return browserAPIKey(email, password)
+}
+
+// sessionAPIKey obtains the API key as a browser would, without one
+func sessionAPIKey(email, password string) (accountID, key string, err error) {
+	ctx := context.Background()
+
+	golog.Debug("Logging in...")
+
+	session, err := sc2replaystats.Login(ctx, email, password, apiOptions()...)
+	if err != nil {
+		return "", "", fmt.Errorf("email login error: %w", err)
+	}
+
+	golog.Debug("Finding API key...")
+
+	if key, err = session.APIKey(ctx); err != nil {
+		return "", "", fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	return session.AccountID, key, nil
+}
+
+// browserAPIKey obtains the API key using a headless Chromium
+func browserAPIKey(email, password string) (accountID, key string, err error) {
+	golog.Debug("Setting up browser...")
+	t := time.Now()
+	pw, browser, page, err := newBrowser()
+	if pw != nil {
+		defer pw.Stop()
+	}
+	if browser != nil {
+		defer browser.Close()
+	}
+	if page != nil {
+		defer page.Close()
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to setup browser: %v", err)
+	}
+	golog.Debugf("browser setup took %s", time.Since(t))
+
+	if accountID, err = login(page, email, password); err != nil {
+		return "", "", fmt.Errorf("email login error: %v", err)
+	}
+
+	if key, err = extractAPIKey(page, accountID); err != nil {
+		return "", "", fmt.Errorf("extractAPIKey error: %v", err)
+	}
+
+	return accountID, key, nil
+}
+
 func extractAPIKey(page *playwright.Page, accountID string) (string, error) {
-	if _, err := page.Goto(fmt.Sprintf("%s/account/settings/%v", sc2replaystats.WebRoot, accountID)); err != nil {
+	if _, err := page.Goto(fmt.Sprintf("%s/account/settings/%v", viper.GetString("api.webUrl"), accountID)); err != nil {
 		return "", fmt.Errorf("failed to navigate to settings page: %v", err)
 	}
 
@@ -152,7 +214,7 @@ func extractAPIKey(page *playwright.Page, accountID string) (string, error) {
 func login(page *playwright.Page, email, password string) (accountID string, err error) {
 	golog.Debug("Navigating to login page...")
 
-	if _, err := page.Goto(fmt.Sprintf("%s/Account/signin", sc2replaystats.WebRoot)); err != nil {
+	if _, err := page.Goto(fmt.Sprintf("%s/Account/signin", viper.GetString("api.webUrl"))); err != nil {
 		return "", fmt.Errorf("failed to navigate to signin page: %v", err)
 	}
 
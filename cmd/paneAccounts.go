@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/container"
@@ -16,6 +17,7 @@ import (
 
 	"github.com/AlbinoGeek/sc2-rsu/cmd/gui"
 	"github.com/AlbinoGeek/sc2-rsu/fynex"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
 	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
 )
 
@@ -23,11 +25,21 @@ type paneAccounts struct {
 	fynex.Pane
 
 	container *fyne.Container
+
+	// updates requests the pane be rebuilt, which run does one at a time
+	updates chan struct{}
+
+	// players are the sc2replaystats players of each API key, which name
+	// the toons, fetched in the background by fetchPlayers
+	players   map[string][]sc2replaystats.AccountPlayer
+	playersMu sync.Mutex
 }
 
 func makePaneAccounts(w gui.Window) fynex.Pane {
 	p := &paneAccounts{
-		Pane: fynex.NewPaneWithIcon("Accounts", accIcon, w),
+		Pane:    fynex.NewPaneWithIcon("Accounts", accIcon, w),
+		updates: make(chan struct{}, 1),
+		players: make(map[string][]sc2replaystats.AccountPlayer),
 	}
 
 	p.container = container.NewVBox()
@@ -39,8 +51,26 @@ func makePaneAccounts(w gui.Window) fynex.Pane {
 }
 
 func (t *paneAccounts) Init() {
-	t.Update()
-	t.container.Refresh()
+	t.RequestUpdate()
+	t.run()
+}
+
+// RequestUpdate has the pane rebuilt, such as once toons were found, without
+// waiting for it; requests made while one is pending are merged into it
+func (t *paneAccounts) RequestUpdate() {
+	select {
+	case t.updates <- struct{}{}:
+	default:
+	}
+}
+
+// run rebuilds the pane for every update requested, so that it is never
+// rebuilt by two goroutines at once
+func (t *paneAccounts) run() {
+	for range t.updates {
+		t.Update()
+		t.container.Refresh()
+	}
 }
 
 func (t *paneAccounts) Refresh() {
@@ -48,16 +78,9 @@ func (t *paneAccounts) Refresh() {
 }
 
 func (t *paneAccounts) Update() {
-	players, err := sc2api.GetAccountPlayers()
-
-	if err != nil {
-		golog.Errorf("GetAccountPlayers: %v", err)
-		return
-	}
-
 	accounts, err := sc2utils.EnumerateAccounts(viper.GetString("replaysRoot"))
 	if err != nil {
-		accounts = []string{"No Accounts Found/"}
+		accounts = []sc2utils.Toon{{ID: "No Accounts Found" + string(filepath.Separator)}}
 	}
 
 	// Clear container if it has objects
@@ -69,34 +92,46 @@ func (t *paneAccounts) Update() {
 	main := t.GetWindow().(*windowMain)
 
 	for acc, list := range toonList(accounts) {
+		// each account may have its own sc2replaystats account (API key)
+		key, own := getAccountAPIKey(acc)
+		keyText := fmt.Sprintf("API key %s (default)", maskAPIKey(key))
+		if own {
+			keyText = fmt.Sprintf("API key %s (account)", maskAPIKey(key))
+		}
+
+		players := t.getPlayers(acc, key)
+
 		for _, toon := range list {
 			name := ""
-
 			// find toon name via sc2replaystats account players
-			parts := strings.Split(toon, "-")
+			parts := strings.Split(filepath.Base(toon.ID), "-")
 			for _, p := range players {
 				if parts[len(parts)-1] == strconv.Itoa(int(p.Player.CharacterID)) {
 					name = p.Player.Name
 				}
 			}
 
-			card := widget.NewCard(name, sc2utils.RegionsMap[parts[0]], nil)
-			id := fmt.Sprintf("%s/%s", acc, toon)
+			// each replay category found may be uploaded or not
+			categories := container.NewHBox()
+			for _, c := range toon.Categories {
+				check := widget.NewCheck(c, nil)
+				check.SetChecked(inSlice(c, getToonCategories(toon.ID)))
+				check.OnChanged = main.toggleCategory(toon, c)
+				categories.Add(check)
+			}
+
+			card := widget.NewCard(name, sc2utils.RegionsMap[parts[0]], container.NewVBox(widget.NewLabel(keyText), categories))
+			id := filepath.ToSlash(toon.ID)
 
 			btnToggle := widget.NewButtonWithIcon("", theme.MediaPauseIcon(), nil)
 			btnToggle.Importance = widget.HighImportance
-			btnToggle.OnTapped = main.toggleUploading(btnToggle, id)
+			btnToggle.OnTapped = main.toggleUploading(btnToggle, toon)
 
 			// todo: reverse this map ( disableUpload )
-			main.uploadEnabled[id] = getToonEnabled(id)
-
-			if !main.uploadEnabled[id] {
-				// 	if err := main.watcher.Remove(filepath.Join(viper.GetString("replaysRoot"), id, "Replays", "Multiplayer")); err != nil {
-				// 		dialog.NewError(err, t.GetWindow().GetWindow())
-
-				// 		return
-				// 	}
+			enabled := getToonEnabled(id)
+			main.setUploadEnabled(id, enabled)
 
+			if !enabled {
 				btnToggle.Importance = widget.MediumImportance
 				btnToggle.Icon = theme.MediaPlayIcon()
 			}
@@ -106,19 +141,60 @@ func (t *paneAccounts) Update() {
 	}
 }
 
-func toonList(accounts []string) (toons map[string][]string) {
-	toons = make(map[string][]string)
+// getPlayers returns the sc2replaystats players of an API key, if fetched
+// already, otherwise fetches them in the background and has the pane rebuilt
+// once they are, so that the toons are named without waiting on the network
+func (t *paneAccounts) getPlayers(accountID, key string) []sc2replaystats.AccountPlayer {
+	if key == "" {
+		return nil
+	}
+
+	t.playersMu.Lock()
+	defer t.playersMu.Unlock()
+
+	players, ok := t.players[key]
+	if !ok {
+		t.players[key] = nil // fetched only once, even if it fails
+
+		go t.fetchPlayers(accountID, key)
+	}
+
+	return players
+}
+
+func (t *paneAccounts) fetchPlayers(accountID, key string) {
+	players, err := newAPIClient(key).GetAccountPlayers()
+	if err != nil {
+		golog.Errorf("failed to list sc2replaystats players of account %s: %v", accountID, describeAPIError(err))
+		return
+	}
+
+	t.playersMu.Lock()
+	t.players[key] = players
+	t.playersMu.Unlock()
+
+	t.RequestUpdate()
+}
+
+// toonList groups toons by the account they belong to
+func toonList(toons []sc2utils.Toon) (accounts map[string][]sc2utils.Toon) {
+	accounts = make(map[string][]sc2utils.Toon)
 
-	for _, acc := range accounts {
-		parts := strings.Split(acc, string(filepath.Separator))
-		toonList, ok := toons[parts[0]]
+	for _, t := range toons {
+		acc := strings.Split(t.ID, string(filepath.Separator))[0]
+		accounts[acc] = append(accounts[acc], t)
+	}
+
+	return accounts
+}
 
-		if !ok {
-			toons[parts[0]] = []string{parts[1]}
-		} else {
-			toons[parts[0]] = append(toonList, parts[1])
+// inSlice returns whether needle is one of haystack
+func inSlice(needle string, haystack []string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
 		}
 	}
 
-	return toons
+	return false
 }
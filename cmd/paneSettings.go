@@ -6,6 +6,7 @@ import (
 	"image/color"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"fyne.io/fyne"
@@ -30,6 +31,14 @@ type paneSettings struct {
 	// do we have unsaved changes in the form?
 	unsaved bool
 
+	// keyChecks caches whether sc2replaystats accepts each API key entered,
+	// as checking takes a request and validators run on every keystroke
+	keyChecks map[string]error
+	keyMu     sync.Mutex
+
+	// keyEntered is the API key last validated, which is what the entry holds
+	keyEntered string
+
 	// widgets
 	apiKey       *widget.Entry
 	autoDownload *widget.Check
@@ -54,10 +63,10 @@ func (settings *paneSettings) Init() {
 	settings.apiKey.SetText(viper.GetString("apiKey"))
 	settings.apiKey.Validator = func(key string) (err error) {
 		if !sc2replaystats.ValidAPIKey(key) {
-			err = errors.New("invalid API key format")
+			return errors.New("invalid API key format")
 		}
 
-		return
+		return settings.verifyKey(key)
 	}
 	settings.apiKey.OnChanged = func(string) {
 		settings.unsaved = true
@@ -297,32 +306,9 @@ func (settings *paneSettings) openLogin() {
 
 	dlg := dialog.NewCustomConfirm("Login to sc2replaystats", "Login", "Cancel", vbox, func(ok bool) {
 		if ok {
-			dlg2 := dialog.NewProgressInfinite("1) Login", "Setting up our login browser...", w)
-			dlg2.Show()
-			pw, browser, page, err := newBrowser()
-
-			if pw != nil {
-				defer pw.Stop()
-			}
-
-			if browser != nil {
-				defer browser.Close()
-			}
-
-			if page != nil {
-				defer page.Close()
-			}
-
-			dlg2.Hide()
-
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("failed setting up browser: %v", err), w)
-				return
-			}
-
-			dlg2 = dialog.NewProgressInfinite("2) Login", "Please wait while we try to login to sc2replaystats...", w)
+			dlg2 := dialog.NewProgressInfinite("Login", "Please wait while we login to sc2replaystats and find or generate your API key...", w)
 			dlg2.Show()
-			accid, err := login(page, user.Text, pass.Text)
+			_, key, err := obtainAPIKey(user.Text, pass.Text)
 			dlg2.Hide()
 
 			if err != nil {
@@ -330,18 +316,6 @@ func (settings *paneSettings) openLogin() {
 				return
 			}
 
-			dlg2 = dialog.NewProgressInfinite("3) Login", "Finding or Generating API Key...", w)
-			dlg2.Show()
-
-			key, err := extractAPIKey(page, accid)
-
-			dlg2.Hide()
-
-			if err != nil {
-				dialog.ShowError(fmt.Errorf("failed to get API key: %v", err), w)
-				return
-			}
-
 			settings.apiKey.SetText(key)
 			settings.apiKey.Validate()
 		}
@@ -379,7 +353,12 @@ func (settings *paneSettings) save() {
 		changes = true
 
 		// Use the new apiKey immediately
-		sc2api = sc2replaystats.New(settings.apiKey.Text)
+		sc2api = nil
+		if settings.apiKey.Text != "" {
+			sc2api = newAPIClient(settings.apiKey.Text)
+		}
+
+		replayUploader.SetClient(sc2api)
 	}
 
 	if oldRoot := viper.Get("replaysRoot"); oldRoot != settings.replaysRoot.Text {
@@ -389,7 +368,7 @@ func (settings *paneSettings) save() {
 	}
 
 	if changes {
-		main.accounts.Refresh()
+		main.accounts.RequestUpdate()
 		main.setupUploader()
 	}
 
@@ -408,6 +387,46 @@ func (settings *paneSettings) save() {
 	settings.unsaved = false
 }
 
+// verifyKey returns whether sc2replaystats accepted an API key, checking it
+// in the background the first time, until which it is accepted; the API key
+// entry shows the error once the check is done, if it still holds that key
+func (settings *paneSettings) verifyKey(key string) error {
+	settings.keyMu.Lock()
+	defer settings.keyMu.Unlock()
+
+	settings.keyEntered = key
+
+	if settings.keyChecks == nil {
+		settings.keyChecks = make(map[string]error)
+	}
+
+	if err, ok := settings.keyChecks[key]; ok {
+		return err
+	}
+
+	settings.keyChecks[key] = nil
+
+	go func() {
+		err := verifyAPIClient(newAPIClient(key))
+		if err != nil {
+			err = errors.New(describeAPIError(err))
+		}
+
+		settings.keyMu.Lock()
+		defer settings.keyMu.Unlock()
+
+		settings.keyChecks[key] = err
+
+		// the entry is neither read nor validated here, off the goroutine
+		// handling input; held, keyMu keeps it from being validated meanwhile
+		if err != nil && settings.keyEntered == key {
+			settings.apiKey.SetValidationError(err)
+		}
+	}()
+
+	return nil
+}
+
 func (settings *paneSettings) validate() error {
 	if err := settings.apiKey.Validate(); settings.apiKey.Text != "" && err != nil {
 		return fmt.Errorf("invalid value for \"API Key\": %v", err)
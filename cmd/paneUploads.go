@@ -12,7 +12,6 @@ import (
 
 	"github.com/AlbinoGeek/sc2-rsu/cmd/gui"
 	"github.com/AlbinoGeek/sc2-rsu/fynex"
-	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
 )
 
 type paneUploads struct {
@@ -35,13 +34,34 @@ func (t *paneUploads) Init() {
 	main := t.GetWindow().(*windowMain)
 
 	t.table = widget.NewTable(
-		func() (int, int) { return len(main.uploadStatus), 3 },
+		func() (int, int) { return main.uploadCount(), 4 },
 		func() fyne.CanvasObject {
-			return fynex.NewScaledText(fynex.TextSizeBody1, "@@@@@@@@")
+			return container.NewMax(
+				fynex.NewScaledText(fynex.TextSizeBody1, "@@@@@@@@"),
+				widget.NewProgressBar(),
+			)
 		},
 		func(tci widget.TableCellID, f fyne.CanvasObject) {
-			l := f.(*canvas.Text)
-			switch atom := main.uploadStatus[tci.Row]; tci.Col {
+			c := f.(*fyne.Container)
+			l := c.Objects[0].(*canvas.Text)
+			bar := c.Objects[1].(*widget.ProgressBar)
+
+			atom, ok := main.uploadRow(tci.Row)
+			if !ok {
+				return
+			}
+
+			if tci.Col == 3 {
+				l.Hide()
+				bar.Show()
+				bar.TextFormatter = atom.progressText
+				bar.SetValue(atom.Progress)
+				return
+			}
+
+			bar.Hide()
+			l.Show()
+			switch tci.Col {
 			case 0:
 				l.Text = atom.MapName
 			case 1:
@@ -53,12 +73,13 @@ func (t *paneUploads) Init() {
 		},
 	)
 	t.table.OnSelected = func(id widget.TableCellID) {
-		if id.Row > len(main.uploadStatus)-1 {
+		atom, ok := main.uploadRow(id.Row)
+		if !ok {
 			return // selected row that does not exist
 		}
 
-		if rid := main.uploadStatus[id.Row].ReplayID; rid != "" {
-			u, _ := url.Parse(fmt.Sprintf("%s/replay/%s", sc2replaystats.WebRoot, rid))
+		if rid := atom.ReplayID; rid != "" {
+			u, _ := url.Parse(replayURL(rid))
 			main.App.OpenURL(u)
 		}
 	}
@@ -67,6 +88,7 @@ func (t *paneUploads) Init() {
 	t.table.SetColumnWidth(0, 230)
 	t.table.SetColumnWidth(1, 86)
 	t.table.SetColumnWidth(2, 90)
+	t.table.SetColumnWidth(3, 100)
 
 	pad := theme.Padding()
 
@@ -82,13 +104,27 @@ func (t *paneUploads) Init() {
 	tblStatus.TextStyle.Bold = true
 	tblStatus.Move(fyne.NewPos(312+pad*7, 0))
 
+	tblProgress := fynex.NewScaledText(fynex.TextSizeSubtitle1, "Progress")
+	tblProgress.TextStyle.Bold = true
+	tblProgress.Move(fyne.NewPos(402+pad*9, 0))
+
 	t.SetContent(container.NewBorder(
 		fyne.NewContainerWithoutLayout(
-			tblName, tblID, tblStatus,
+			tblName, tblID, tblStatus, tblProgress,
 		), nil, nil, nil, t.table,
 	))
 }
 
+// progressText shows the size of a replay once it was sent, or how much of
+// it was sent so far while uploading
+func (r *uploadRecord) progressText() string {
+	if r.Progress > 0 && r.Progress < 1 {
+		return fmt.Sprintf("%.0f%%", r.Progress*100)
+	}
+
+	return r.Filesize
+}
+
 func (t *paneUploads) Refresh() {
 	t.table.Refresh()
 }
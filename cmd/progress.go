@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"golang.org/x/term"
+
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+// progressLine is the single line of the terminal showing the progress of
+// the replay being uploaded in text mode, rewritten in place as it moves
+// along and cleared before anything else is logged
+var progressLine struct {
+	sync.Mutex
+	shown bool
+}
+
+// showProgress rewrites the progress line, unless the output is no terminal
+func showProgress(ev uploader.Event) {
+	if !term.IsTerminal(int(os.Stdout.Fd())) {
+		return
+	}
+
+	var text string
+
+	if ev.Polls > 0 {
+		text = fmt.Sprintf("processing %s: waiting for sc2replaystats (%d)", ev.MapName, ev.Polls)
+	} else if ev.Total > 0 {
+		const width = 20
+
+		done := int(ev.Sent * width / ev.Total)
+		text = fmt.Sprintf("uploading %s [%s%s] %3d%% of %s",
+			ev.MapName,
+			strings.Repeat("#", done),
+			strings.Repeat(".", width-done),
+			ev.Sent*100/ev.Total,
+			humanize.Bytes(uint64(ev.Size)))
+	}
+
+	if max := termWidth - 1; len(text) > max && max > 0 {
+		text = text[:max]
+	}
+
+	progressLine.Lock()
+	defer progressLine.Unlock()
+
+	fmt.Printf("\r%-*s", termWidth-1, text)
+	progressLine.shown = true
+}
+
+// clearProgress blanks the progress line (if shown), so that the next line
+// logged starts at the beginning of it
+func clearProgress() {
+	progressLine.Lock()
+	defer progressLine.Unlock()
+
+	if progressLine.shown {
+		fmt.Printf("\r%s\r", strings.Repeat(" ", termWidth-1))
+		progressLine.shown = false
+	}
+}
@@ -2,8 +2,9 @@ package cmd
 
 import (
 	"bufio"
-	"errors"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -12,7 +13,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/kataras/golog"
 	"github.com/mitchellh/go-wordwrap"
 
@@ -20,12 +20,15 @@ import (
 	"github.com/spf13/viper"
 
 	"github.com/AlbinoGeek/sc2-rsu/cmd/gui"
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
 	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
 	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
 	"github.com/AlbinoGeek/sc2-rsu/utils"
 )
 
-const validReplaySize = 26 * 1024
+// wakeInterval is how often the clock is checked for having slept
+const wakeInterval = time.Minute
 
 var (
 	// GUI is the application's graphical interface
@@ -48,78 +51,58 @@ var (
 				return nil
 			}
 
-			key := viper.GetString("apikey")
-			if key == "" {
-				return errors.New("no API key in configuration, please use the login command")
-			}
-
-			if !sc2replaystats.ValidAPIKey(key) {
-				return errors.New("invalid API key in configuration, please replace it or use the login command")
-			}
-
-			paths, err := getWatchPaths()
-			if err != nil {
-				return err
-			}
-
 			golog.Info("Starting Automatic Replay Uploader...")
-			sc2api = sc2replaystats.New(key)
 
-			done := make(chan struct{})
-			w, err := newWatcher(paths)
+			svc, err := startUploadService(true)
 			if err != nil {
 				return err
 			}
-			defer w.Close()
-
-			go func() {
-				for {
-					select {
-					case event, ok := <-w.Events:
-						if !ok {
-							return
-						}
-
-						if event.Op&fsnotify.Create == fsnotify.Create {
-							// bug: SC2 sometime writes out ".SC2Replay.writeCacheBackup" files
-							if strings.HasSuffix(event.Name, "eplay") {
-								go handleReplay(event.Name)
-							}
-						}
-					case err, ok := <-w.Errors:
-						if !ok {
-							return
-						}
-
-						golog.Warnf("fswatcher error: %v", err)
-					}
-				}
-			}()
-
-			// Setup Interrupt (Ctrl+C) Handler
-			c := make(chan os.Signal)
-			signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-			go func() {
-				sig := <-c
-				fmt.Println()
-				golog.Warnf("Received signal:%v, Quitting.", sig)
-				close(done)
-			}()
+
+			done := cancelOnInterrupt()
 
 			golog.Debugf("Startup took: %v", time.Since(startTime))
 			golog.Info("Ready!")
 			<-done
 
+			// no new uploads may start while waiting for those in-flight
+			svc.stop()
+
 			return nil
 		},
 	}
-	sc2api    *sc2replaystats.Client
-	startTime = time.Now()
-	termWidth = 80
-	textMode  bool
+	sc2api         *sc2replaystats.Client
+	replayUploader *uploader.Uploader
+	startTime      = time.Now()
+	termWidth      = 80
+	textMode       bool
+
+	// uploadCtx is cancelled when the program is quitting, which cancels all
+	// uploads in-flight; they are resumed once the program starts again
+	uploadCtx, cancelUploads = context.WithCancel(context.Background())
 )
 
-func findReplaysRoot() (string, error) {
+// cancelOnInterrupt cancels all uploads once an interrupt (Ctrl+C) or
+// termination signal was received, returning a channel closed afterwards
+func cancelOnInterrupt() <-chan struct{} {
+	done := make(chan struct{})
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		sig := <-c
+		fmt.Println()
+		golog.Warnf("Received signal:%v, Quitting.", sig)
+		cancelUploads()
+		close(done)
+	}()
+
+	return done
+}
+
+// findReplaysRoot searches the home directory for replays directories, asking
+// which one to use if more than one is found, unless not interactive
+func findReplaysRoot(interactive bool) (string, error) {
 	scanRoot := "/"
 	if home, err := os.UserHomeDir(); err == nil {
 		scanRoot = home
@@ -132,6 +115,10 @@ func findReplaysRoot() (string, error) {
 
 	root := roots[0]
 
+	if len(roots) > 1 && !interactive {
+		return "", fmt.Errorf("found more than one replays directory, please configure replaysRoot as one of: %s", strings.Join(roots, ", "))
+	}
+
 	if len(roots) > 1 {
 		line := strings.Repeat("=", termWidth/2)
 		fmt.Printf("\n%s\n%s\n", line, wordwrap.WrapString("More than one possible replay directory was located while we scanned for your StarCraft II installation's Accounts folder.\n\nPlease select which directory we should be watching below:", uint(termWidth/2)))
@@ -160,112 +147,300 @@ func findReplaysRoot() (string, error) {
 	return root, nil
 }
 
-func getWatchPaths() ([]string, error) {
+// getReplaysRoot returns the configured replays directory, searching for it
+// (and saving it) when it is not configured correctly, see findReplaysRoot
+func getReplaysRoot(interactive bool) (string, error) {
 	replaysRoot := viper.GetString("replaysRoot")
-	if f, err := os.Stat(replaysRoot); err != nil || !f.IsDir() {
-		golog.Warn("Replay Root not configured correctly, searching for replays directory...")
-		golog.Info("Determining replays directory... (this could take a few minutes)...")
+	if f, err := os.Stat(replaysRoot); err == nil && f.IsDir() {
+		return replaysRoot, nil
+	}
 
-		root, err := findReplaysRoot()
-		if err != nil {
-			golog.Fatal(err)
+	golog.Warn("Replay Root not configured correctly, searching for replays directory...")
+	golog.Info("Determining replays directory... (this could take a few minutes)...")
+
+	root, err := findReplaysRoot(interactive)
+	if err != nil {
+		return "", err
+	}
+
+	viper.Set("replaysRoot", root)
+
+	if err := saveConfig(); err != nil {
+		return "", err
+	}
+
+	golog.Infof("Using replays directory: %v", root)
+
+	return root, nil
+}
+
+// toonReplaysPath returns the directory the replays of a category, such as
+// "Multiplayer", are saved in for a toon given as "AccountID/ToonID"
+func toonReplaysPath(replaysRoot, toon, category string) string {
+	return filepath.Join(replaysRoot, filepath.FromSlash(toon), "Replays", category)
+}
+
+// toonWatchPaths returns the replay directories watched for a toon, which are
+// those of the categories configured for it (see getToonCategories) it has
+func toonWatchPaths(replaysRoot string, toon sc2utils.Toon) []string {
+	paths := make([]string, 0)
+
+	for _, c := range getToonCategories(toon.ID) {
+		if toon.HasCategory(c) {
+			paths = append(paths, toonReplaysPath(replaysRoot, toon.ID, c))
 		}
+	}
+
+	return paths
+}
+
+// logUploadEvent reports the progress of replays being uploaded in text mode
+func logUploadEvent(ev uploader.Event) {
+	if ev.Type == uploader.EventProgress {
+		showProgress(ev)
+		return
+	}
+
+	clearProgress()
+
+	switch ev.Type {
+	case uploader.EventQueued:
+		golog.Debugf("uploading replay: %v", ev.Filename)
+	case uploader.EventProcessing:
+		golog.Infof("sc2replaystats accepted : [%v] %s", ev.QueueID, ev.MapName)
+	case uploader.EventSuccess:
+		golog.Infof("sc2replaystats processed: [%v] %s", ev.QueueID, ev.ReplayID)
+	case uploader.EventDuplicate:
+		golog.Infof("sc2replaystats duplicate: [%v] %s", ev.QueueID, ev.ReplayID)
+	case uploader.EventSkipped:
+		golog.Infof("already uploaded, skipping: [%v] %s", ev.ReplayID, ev.MapName)
+	case uploader.EventExcluded:
+		golog.Infof("excluded, skipping: %s: %s", ev.MapName, ev.Reason)
+	case uploader.EventFailed:
+		golog.Errorf("failed to upload replay: %v: %v", ev.MapName, describeAPIError(ev.Err))
+	}
+}
 
-		viper.Set("replaysRoot", root)
+// newFileWatcher returns the watcher chosen by "watcher.mode": "auto"
+// (notifications where they work, polling elsewhere), "notify" or "poll",
+// polling every "watcher.pollInterval"
+func newFileWatcher() (fswatch.Watcher, error) {
+	interval, err := time.ParseDuration(viper.GetString("watcher.pollInterval"))
+	if err != nil || interval <= 0 {
+		return nil, fmt.Errorf("invalid watcher.pollInterval: %q", viper.GetString("watcher.pollInterval"))
+	}
 
-		if err := saveConfig(); err != nil {
+	switch mode := viper.GetString("watcher.mode"); mode {
+	case "", "auto":
+		return fswatch.NewAuto(interval), nil
+	case "notify":
+		w, err := fswatch.NewNotify()
+		if err != nil {
 			return nil, err
 		}
 
-		golog.Infof("Using replays directory: %v", root)
-		replaysRoot = root
+		return w, nil
+	case "poll":
+		return fswatch.NewPoll(interval), nil
+	default:
+		return nil, fmt.Errorf("unknown watcher.mode: %q", mode)
 	}
+}
 
-	accs, err := sc2utils.EnumerateAccounts(replaysRoot)
-	golog.Debugf("account scan returned: %v toons", len(accs))
-
+// newWatcher returns a watcher watching every path given
+func newWatcher(paths []string) (fswatch.Watcher, error) {
+	w, err := newFileWatcher()
 	if err != nil {
-		return nil, fmt.Errorf("getWatchPaths: %v", err)
+		return nil, err
 	}
 
-	paths := make([]string, 0)
+	for _, p := range paths {
+		golog.Debugf("Watching replays directory: %v", p)
 
-	for _, a := range accs {
-		p := filepath.Join(replaysRoot, a, "Replays", "Multiplayer")
-		if f, err := os.Stat(p); err == nil && f.IsDir() {
-			paths = append(paths, p)
+		if err = w.Add(p); err != nil {
+			w.Close()
+			return nil, fmt.Errorf("failed to watch replay directory: %v: %v", p, err)
 		}
 	}
 
-	return paths, nil
+	return w, nil
 }
 
-func handleReplay(replayFilename string) {
-	golog.Debugf("uploading replay: %v", replayFilename)
+// watchReplayPath starts watching a replay directory created while running,
+// calling handler with the replays saved in it before it was watched, as the
+// first replay of a category is saved right as its directory is created
+func watchReplayPath(w fswatch.Watcher, dir string, handler func(string)) error {
+	if err := w.Add(dir); err != nil {
+		return fmt.Errorf("failed to watch replay directory: %v: %v", dir, err)
+	}
 
-	// wait for the replay to have finished being written (large enough filesize)
-	var lastSize int64
+	golog.Infof("Watching new replays directory: %v", dir)
 
-	for {
-		time.Sleep(time.Millisecond * 250)
-
-		// ! smallest replay I've seen is 27418 bytes (-3 second long)
-		if s, err := os.Stat(replayFilename); err == nil && s.Size() > validReplaySize {
-			// check that the replay has stopped growing
-			if s.Size() > lastSize {
-				lastSize = s.Size()
-			} else {
-				break
-			}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil // the watcher reports any replays from now on
+	}
+
+	for _, f := range infos {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), uploader.ReplayExt) {
+			handler(filepath.Join(dir, f.Name()))
 		}
 	}
 
-	rqid, err := sc2api.UploadReplay(replayFilename)
-	_, mapName, _ := utils.SplitFilepath(replayFilename)
+	return nil
+}
 
+// watchAccounts calls found with every toon, or replay category of a toon,
+// created under replaysRoot (see sc2utils.AccountWatcher), until the watcher
+// returned is closed
+func watchAccounts(replaysRoot string, found func(sc2utils.Toon)) (*sc2utils.AccountWatcher, error) {
+	w, err := newFileWatcher()
 	if err != nil {
-		golog.Errorf("failed to upload replay: %v: %v", mapName, err)
-		return
+		return nil, err
+	}
+
+	a, err := sc2utils.WatchAccounts(replaysRoot, w)
+	if err != nil {
+		return nil, fmt.Errorf("failed to watch for new accounts: %v", err)
 	}
 
-	golog.Infof("sc2replaystats accepted : [%v] %s", rqid, mapName)
+	go func() {
+		for t := range a.Toons() {
+			found(t)
+		}
+	}()
+
+	return a, nil
+}
+
+// watchPaths returns the replay directories watched for the toons enabled
+func watchPaths(replaysRoot string, toons []sc2utils.Toon) []string {
+	paths := make([]string, 0, len(toons))
+
+	for _, t := range toons {
+		if getToonEnabled(filepath.ToSlash(t.ID)) {
+			paths = append(paths, toonWatchPaths(replaysRoot, t)...)
+		}
+	}
 
-	go watchReplayStatus(rqid)
+	return paths
 }
 
-func newWatcher(paths []string) (w *fsnotify.Watcher, err error) {
-	watcher, err := fsnotify.NewWatcher()
+// catchUp uploads the replays saved in paths while nothing watched them (see
+// uploader.Missed), looking back at most "catchUp.lookback", or not at all if
+// it is zero
+func catchUp(paths []string) {
+	lookback, err := time.ParseDuration(viper.GetString("catchUp.lookback"))
+	if err != nil || lookback < 0 {
+		golog.Errorf("invalid catchUp.lookback: %q", viper.GetString("catchUp.lookback"))
+		return
+	}
+
+	if lookback == 0 {
+		return
+	}
+
+	missed, err := replayUploader.Missed(paths, lookback)
 	if err != nil {
-		return nil, fmt.Errorf("failed to setup fswatcher: %v", err)
+		golog.Errorf("failed to look for missed replays: %v", err)
+		return
 	}
 
-	for _, p := range paths {
-		golog.Debugf("Watching replays directory: %v", p)
+	if len(missed) > 0 {
+		golog.Infof("Found %d replays saved while not watching", len(missed))
+	}
 
-		if err = watcher.Add(p); err != nil {
-			golog.Fatalf("failed to watch replay directory: %v: %v", p, err)
-		}
+	for _, f := range missed {
+		handleReplay(f)
 	}
+}
 
-	return watcher, nil
+// catchUpOnWake calls catchUp with the paths returned by paths each time the
+// computer resumes from sleep, until uploads are cancelled
+func catchUpOnWake(paths func() []string) {
+	utils.OnWake(uploadCtx, wakeInterval, func(slept time.Duration) {
+		golog.Infof("Resumed after %v asleep, looking for missed replays", slept.Round(time.Second))
+		catchUp(paths())
+	})
 }
 
-func watchReplayStatus(rqid string) {
-	for {
-		time.Sleep(time.Second)
+// handleReplay queues a replay found by the watcher to be uploaded
+func handleReplay(replayFilename string) {
+	replayUploader.Enqueue(uploadCtx, replayFilename)
+}
 
-		rid, err := sc2api.GetReplayStatus(rqid)
+// uploadLimits are how many replays are uploaded at once ("upload.workers"),
+// how long new replays may take to be written ("upload.writeTimeout") and how
+// long their processing is followed ("upload.maxPolling")
+type uploadLimits struct {
+	workers      int
+	maxPolling   time.Duration
+	writeTimeout time.Duration
+}
 
-		if err != nil {
-			golog.Errorf("error checking reply status: %v: %v", rqid, err)
-			return // could not check status
-		}
+// getUploadLimits returns the upload limits configured
+func getUploadLimits() (uploadLimits, error) {
+	var l uploadLimits
 
-		if rid != "" {
-			golog.Infof("sc2replaystats processed: [%v] %s", rqid, rid)
-			return // replay parsed!
-		}
+	if l.workers = viper.GetInt("upload.workers"); l.workers < 1 {
+		return l, fmt.Errorf("invalid upload.workers: %d", l.workers)
+	}
+
+	var err error
+	if l.maxPolling, err = time.ParseDuration(viper.GetString("upload.maxPolling")); err != nil || l.maxPolling < 0 {
+		return l, fmt.Errorf("invalid upload.maxPolling: %q", viper.GetString("upload.maxPolling"))
+	}
+
+	if l.writeTimeout, err = time.ParseDuration(viper.GetString("upload.writeTimeout")); err != nil || l.writeTimeout <= 0 {
+		return l, fmt.Errorf("invalid upload.writeTimeout: %q", viper.GetString("upload.writeTimeout"))
+	}
+
+	return l, nil
+}
+
+// apply applies the upload limits to the uploader
+func (l uploadLimits) apply() {
+	replayUploader.SetWorkers(l.workers)
+	replayUploader.SetMaxPolling(l.maxPolling)
+	replayUploader.SetWriteTimeout(l.writeTimeout)
+}
 
-		golog.Debugf("sc2replaystats process..: [%v] %s", rqid, rid)
+// setUploadLimits applies the upload limits configured to the uploader
+func setUploadLimits() error {
+	limits, err := getUploadLimits()
+	if err != nil {
+		return err
+	}
+
+	limits.apply()
+
+	return nil
+}
+
+// watchReplays calls handler with every replay created in the directories
+// watched by w, until w is closed
+func watchReplays(w fswatch.Watcher, handler func(string)) {
+	for {
+		select {
+		case event, ok := <-w.Events():
+			if !ok {
+				return
+			}
+
+			if event.Op == fswatch.Create {
+				// SC2 sometimes writes replays to a ".writeCacheBackup" first,
+				// which the uploader waits to be renamed to the replay
+				name := strings.TrimSuffix(event.Name, uploader.BackupExt)
+				if strings.HasSuffix(name, uploader.ReplayExt) {
+					handler(name)
+				}
+			}
+		case err, ok := <-w.Errors():
+			if !ok {
+				return
+			}
+
+			golog.Warnf("fswatcher error: %v", err)
+		}
 	}
 }
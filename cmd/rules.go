@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/rules"
+)
+
+// getUploadRules returns the "filters" configured, deciding which replays are
+// uploaded based on their metadata; see package rules for the format
+func getUploadRules() (rules.Set, error) {
+	var set rules.Set
+
+	if err := viper.UnmarshalKey("filters", &set); err != nil {
+		return nil, fmt.Errorf("invalid filters in configuration: %v", err)
+	}
+
+	if err := set.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid filters in configuration: %v", err)
+	}
+
+	return set, nil
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bgentry/speakeasy"
+	"github.com/kataras/golog"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+
+	"github.com/AlbinoGeek/sc2-rsu/secrets"
+)
+
+// passphraseEnv names the environment variable which may hold the passphrase
+// of the encrypted secrets file, for when there is no terminal to ask on
+const passphraseEnv = "SC2RSU_PASSPHRASE"
+
+var (
+	// secretKeys are the configuration keys kept in secretStore instead of
+	// the configuration file, see loadSecrets
+	secretKeys = []string{"apikey", "accountKeys"}
+
+	// secretStore keeps the API keys, or is nil if "secrets.backend" is
+	// "none", or "auto" without a keyring nor way to ask for a passphrase, in
+	// which case they stay in the configuration file
+	secretStore secrets.Store
+
+	// storedSecrets are the values last read from or written to secretStore,
+	// so that unchanged secrets are not written again
+	storedSecrets = make(map[string]string)
+)
+
+// getSecretsPath returns where the encrypted secrets file is stored, which is
+// next to the configuration file unless "secrets.path" is configured
+func getSecretsPath() string {
+	if p := viper.GetString("secrets.path"); p != "" {
+		return p
+	}
+
+	dir := "."
+	if cfg := viper.ConfigFileUsed(); cfg != "" {
+		dir = filepath.Dir(cfg)
+	}
+
+	return filepath.Join(dir, fmt.Sprintf("%s.secrets", PROGRAM))
+}
+
+// openSecretStore returns the store chosen by "secrets.backend": "auto" (the
+// keyring where available, otherwise the encrypted file if there is a way to
+// get its passphrase, otherwise none), "keyring", "file" or "none"
+func openSecretStore() (secrets.Store, error) {
+	switch backend := viper.GetString("secrets.backend"); backend {
+	case "", "auto":
+		store, err := secrets.NewSecretService(PROGRAM)
+		if err == nil {
+			return store, nil
+		}
+
+		golog.Debugf("no keyring to keep API keys in: %v", err)
+
+		if canAskPassphrase() {
+			return secrets.NewFile(getSecretsPath(), askPassphrase), nil
+		}
+
+		golog.Warnf("API keys are stored in PLAINTEXT in the configuration file: there is no keyring, nor a terminal or %s for the passphrase of an encrypted file", passphraseEnv)
+
+		return nil, nil
+	case "keyring":
+		return secrets.NewSecretService(PROGRAM)
+	case "file":
+		return secrets.NewFile(getSecretsPath(), askPassphrase), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown secrets.backend: %q", backend)
+	}
+}
+
+// canAskPassphrase returns whether askPassphrase has a way to get the
+// passphrase of the encrypted secrets file
+func canAskPassphrase() bool {
+	return os.Getenv(passphraseEnv) != "" || term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// askPassphrase returns the passphrase of the encrypted secrets file from
+// the environment, or asks for it on the terminal
+func askPassphrase() (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+
+	if !canAskPassphrase() {
+		return "", fmt.Errorf("no terminal to ask on, please set %s", passphraseEnv)
+	}
+
+	return speakeasy.Ask(fmt.Sprintf("Passphrase for %s: ", getSecretsPath()))
+}
+
+// loadSecrets opens the secret store, moves any API keys still found in the
+// configuration file into it, and makes those stored available through viper
+// as if they were configured, such as viper.GetString("apikey")
+func loadSecrets() {
+	store, err := openSecretStore()
+	if err != nil {
+		golog.Warnf("API keys are kept in the configuration file: %v", err)
+		return
+	}
+
+	if store == nil {
+		return
+	}
+
+	secretStore = store
+	golog.Debugf("using secret store: %v", store)
+
+	var migrate bool
+
+	for _, key := range secretKeys {
+		if value := encodeSecret(key); value != "" && viper.InConfig(strings.ToLower(key)) {
+			migrate = true
+			continue
+		}
+
+		value, err := store.Get(key)
+		if errors.Is(err, secrets.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			golog.Errorf("failed to read %s from %v: %v", key, store, err)
+			continue
+		}
+
+		if err = decodeSecret(key, value); err != nil {
+			golog.Errorf("failed to read %s from %v: %v", key, store, err)
+			continue
+		}
+
+		storedSecrets[key] = value
+	}
+
+	if migrate {
+		if err := saveConfig(); err == nil {
+			golog.Infof("Moved API keys from the configuration file into the %v", store)
+		}
+	}
+}
+
+// unloadSecrets forgets the secrets loadSecrets made available through viper,
+// which would otherwise hide those of a configuration file read again
+func unloadSecrets() {
+	for _, key := range secretKeys {
+		viper.Set(key, nil)
+	}
+
+	secretStore = nil
+	storedSecrets = make(map[string]string)
+}
+
+// saveSecrets writes the secrets configured into the secret store (if any),
+// and removes them from the settings about to be written to the
+// configuration file once they were
+func saveSecrets(settings map[string]interface{}) error {
+	if secretStore == nil {
+		return nil
+	}
+
+	for _, key := range secretKeys {
+		value := encodeSecret(key)
+		if stored, ok := storedSecrets[key]; ok && stored == value {
+			continue
+		}
+
+		var err error
+		if value == "" {
+			err = secretStore.Delete(key)
+		} else {
+			err = secretStore.Set(key, value)
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to save %s to %v: %v", key, secretStore, err)
+		}
+
+		storedSecrets[key] = value
+	}
+
+	for _, key := range secretKeys {
+		delete(settings, strings.ToLower(key))
+	}
+
+	return nil
+}
+
+// encodeSecret returns the configured value of a secret as stored, or an
+// empty string if it is not configured
+func encodeSecret(key string) string {
+	if key != "accountKeys" {
+		return viper.GetString(key)
+	}
+
+	keys := viper.GetStringMapString(key)
+	if len(keys) == 0 {
+		return ""
+	}
+
+	data, _ := json.Marshal(keys)
+
+	return string(data)
+}
+
+// decodeSecret configures a secret from its stored value
+func decodeSecret(key, value string) error {
+	if key != "accountKeys" {
+		viper.Set(key, value)
+		return nil
+	}
+
+	keys := make(map[string]string)
+	if err := json.Unmarshal([]byte(value), &keys); err != nil {
+		return err
+	}
+
+	viper.Set(key, keys)
+
+	return nil
+}
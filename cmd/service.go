@@ -0,0 +1,319 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/kataras/golog"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/statusapi"
+	"github.com/AlbinoGeek/sc2-rsu/systemd"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+// uploadService watches the replay directories of every toon enabled and
+// uploads new replays, as both text mode and the daemon do
+type uploadService struct {
+	accounts    *sc2utils.AccountWatcher
+	api         *http.Server
+	interactive bool
+	metrics     *http.Server
+	mu          sync.Mutex
+	paths       []string
+	replaysRoot string
+	toons       []sc2utils.Toon
+	watcher     fswatch.Watcher
+}
+
+// startUploadService opens the ledger, applies the configuration, starts the
+// status API and metrics (when enabled), resumes any uploads which were
+// interrupted and uploads replays saved while not running; unless interactive,
+// it never asks for anything on the terminal, as the daemon has none
+func startUploadService(interactive bool) (*uploadService, error) {
+	if err := openLedger(); err != nil {
+		return nil, err
+	}
+
+	replayUploader = uploader.New(nil, replayLedger)
+	replayUploader.Subscribe(logUploadEvent)
+
+	s := &uploadService{interactive: interactive}
+	if err := s.configure(); err != nil {
+		closeLedger()
+		return nil, err
+	}
+
+	var err error
+	if s.api, err = startStatusServer(s); err == nil {
+		s.metrics, err = startMetricsServer(s)
+	}
+
+	if err != nil {
+		s.stop()
+		return nil, err
+	}
+
+	replayUploader.Resume(uploadCtx)
+	catchUp(s.WatchPaths())
+
+	go catchUpOnWake(s.WatchPaths)
+
+	return s, nil
+}
+
+// configure applies the API keys and upload rules configured, and watches
+// the replay directories of the toons enabled, and for new toons, replacing
+// those watched before; nothing is changed unless all of them could be
+func (s *uploadService) configure() error {
+	client, accountClients, err := newAPIClients()
+	if err != nil {
+		return err
+	}
+
+	if client != nil {
+		if err = verifyAPIClient(client); err != nil {
+			return fmt.Errorf("apikey: %v", describeAPIError(err))
+		}
+	}
+
+	for acc, c := range accountClients {
+		if err = verifyAPIClient(c); err != nil {
+			return fmt.Errorf("API key of account %s: %v", acc, describeAPIError(err))
+		}
+	}
+
+	filters, err := getUploadRules()
+	if err != nil {
+		return err
+	}
+
+	limits, err := getUploadLimits()
+	if err != nil {
+		return err
+	}
+
+	replaysRoot, err := getReplaysRoot(s.interactive)
+	if err != nil {
+		return err
+	}
+
+	toons, err := sc2utils.EnumerateAccounts(replaysRoot)
+	if err != nil {
+		return fmt.Errorf("failed to find toons: %v", err)
+	}
+
+	paths := watchPaths(replaysRoot, toons)
+
+	w, err := newWatcher(paths)
+	if err != nil {
+		return err
+	}
+
+	limits.apply()
+	sc2api = client
+	replayUploader.SetClient(client)
+	replayUploader.SetAccountClients(accountClients)
+	replayUploader.SetRules(filters)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+
+	if s.accounts != nil {
+		s.accounts.Close()
+	}
+
+	s.paths, s.replaysRoot, s.toons, s.watcher = paths, replaysRoot, toons, w
+
+	go watchReplays(w, handleReplay)
+
+	// new toons are only added once the watcher is in place, as s.mu is held
+	if s.accounts, err = watchAccounts(replaysRoot, s.addToon); err != nil {
+		golog.Warnf("new toons will not be found until restarted: %v", err)
+	}
+
+	return nil
+}
+
+// addToon adds a toon, or replay categories of a toon, found while running,
+// watching their replay directories if the toon is enabled
+func (s *uploadService) addToon(found sc2utils.Toon) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := 0
+	for i < len(s.toons) && s.toons[i].ID != found.ID {
+		i++
+	}
+
+	if i == len(s.toons) {
+		golog.Infof("Found new toon: %v", filepath.ToSlash(found.ID))
+		s.toons = append(s.toons, sc2utils.Toon{ID: found.ID})
+	}
+
+	s.toons[i].Categories = append(s.toons[i].Categories, found.Categories...)
+	sort.Strings(s.toons[i].Categories)
+
+	if !getToonEnabled(filepath.ToSlash(found.ID)) {
+		return
+	}
+
+	for _, p := range toonWatchPaths(s.replaysRoot, found) {
+		if err := watchReplayPath(s.watcher, p, handleReplay); err != nil {
+			golog.Error(err)
+			continue
+		}
+
+		s.paths = append(s.paths, p)
+	}
+}
+
+// reload reads the configuration file and the secrets again, then applies
+// them
+func (s *uploadService) reload() error {
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to reload configuration: %v", err)
+	}
+
+	unloadSecrets()
+	loadSecrets()
+
+	return s.configure()
+}
+
+// status describes what the service is doing, for systemd
+func (s *uploadService) status() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return systemd.Status("Watching %d replay directories", len(s.paths))
+}
+
+// stop stops watching for new replays and waits for the uploads in-flight,
+// which return early once cancelled by cancelUploads
+func (s *uploadService) stop() {
+	for _, srv := range []*http.Server{s.api, s.metrics} {
+		if srv != nil {
+			srv.Close()
+		}
+	}
+
+	s.mu.Lock()
+	if s.accounts != nil {
+		s.accounts.Close()
+	}
+
+	s.watcher.Close()
+	s.mu.Unlock()
+
+	replayUploader.Wait()
+	closeLedger()
+}
+
+// Toons returns every toon found under the replays directory, for the
+// status API
+func (s *uploadService) Toons() []statusapi.Toon {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	toons := make([]statusapi.Toon, 0, len(s.toons))
+	for _, t := range s.toons {
+		toons = append(toons, statusapi.Toon{
+			ID:         filepath.ToSlash(t.ID),
+			Enabled:    getToonEnabled(filepath.ToSlash(t.ID)),
+			Path:       filepath.Join(s.replaysRoot, t.ID, "Replays"),
+			Categories: append([]string{}, t.Categories...),
+			Watched:    getToonCategories(t.ID),
+		})
+	}
+
+	return toons
+}
+
+// SetToonEnabled starts or stops watching the replay directories of a toon,
+// and saves which toons are enabled, as the Accounts pane does
+func (s *uploadService) SetToonEnabled(toon string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *sc2utils.Toon
+
+	enabledToons := make([]string, 0, len(s.toons))
+
+	for i, t := range s.toons {
+		id := filepath.ToSlash(t.ID)
+		if id == toon {
+			found = &s.toons[i]
+			if enabled {
+				enabledToons = append(enabledToons, id)
+			}
+		} else if getToonEnabled(id) {
+			enabledToons = append(enabledToons, id)
+		}
+	}
+
+	if found == nil {
+		return fmt.Errorf("%w: no toon %s", statusapi.ErrNotFound, toon)
+	}
+
+	// no toons configured means all of them are enabled
+	if len(enabledToons) == 0 {
+		return fmt.Errorf("%w: cannot pause the last toon enabled", statusapi.ErrConflict)
+	}
+
+	for _, p := range toonWatchPaths(s.replaysRoot, *found) {
+		watched := -1
+
+		for i, w := range s.paths {
+			if w == p {
+				watched = i
+			}
+		}
+
+		switch {
+		case enabled && watched < 0:
+			if err := s.watcher.Add(p); err != nil {
+				return fmt.Errorf("failed to watch replay directory: %v: %v", p, err)
+			}
+
+			s.paths = append(s.paths, p)
+		case !enabled && watched >= 0:
+			if err := s.watcher.Remove(p); err != nil {
+				return fmt.Errorf("failed to stop watching replay directory: %v: %v", p, err)
+			}
+
+			s.paths = append(s.paths[:watched], s.paths[watched+1:]...)
+		}
+	}
+
+	return setToons(enabledToons)
+}
+
+// WatchPaths returns the replay directories watched, for the status API
+func (s *uploadService) WatchPaths() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.paths...)
+}
+
+// Retry uploads a replay again, for the status API
+func (s *uploadService) Retry(replayFilename string) error {
+	if _, err := os.Stat(replayFilename); err != nil {
+		return fmt.Errorf("%w: %v", statusapi.ErrNotFound, err)
+	}
+
+	replayUploader.EnqueueUpload(uploadCtx, replayFilename, false)
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/kataras/golog"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/metrics"
+	"github.com/AlbinoGeek/sc2-rsu/statusapi"
+)
+
+// startStatusServer serves the status API on "status.address" when
+// "status.enabled" is set, or returns nil otherwise
+func startStatusServer(ctl statusapi.Controller) (*http.Server, error) {
+	if !viper.GetBool("status.enabled") {
+		return nil, nil
+	}
+
+	addr := viper.GetString("status.address")
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status.address: %v", err)
+	}
+
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("invalid status.address: %q is not localhost", host)
+	}
+
+	api := statusapi.New(ctl, replayLedger)
+	api.Version = VERSION
+	replayUploader.Subscribe(api.OnEvent)
+
+	return serve("status API", addr, "/api/status", api)
+}
+
+// startMetricsServer serves Prometheus metrics on "metrics.address" when
+// "metrics.enabled" is set, or returns nil otherwise; unlike the status API,
+// they may be served to other computers, as they change nothing
+func startMetricsServer(ctl statusapi.Controller) (*http.Server, error) {
+	if !viper.GetBool("metrics.enabled") {
+		return nil, nil
+	}
+
+	registry := metrics.NewRegistry()
+	uploads := metrics.NewUploads(registry, func() int {
+		return len(ctl.WatchPaths())
+	})
+	replayUploader.Subscribe(uploads.OnEvent)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry)
+
+	return serve("metrics", viper.GetString("metrics.address"), "/metrics", mux)
+}
+
+// serve listens on addr and serves handler until the server returned is
+// closed, logging where path can be found
+func serve(name, addr, path string, handler http.Handler) (*http.Server, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %v", name, err)
+	}
+
+	srv := &http.Server{Handler: handler}
+
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			golog.Errorf("%s stopped: %v", name, err)
+		}
+	}()
+
+	golog.Infof("Serving %s on: http://%v%s", name, ln.Addr(), path)
+
+	return srv, nil
+}
@@ -1,16 +1,332 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/kataras/golog"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+	"github.com/AlbinoGeek/sc2-rsu/utils"
 )
 
 var uploadCmd = &cobra.Command{
 	Use:   "upload [filter]",
-	Args:  cobra.MinimumNArgs(1),
+	Args:  cobra.MaximumNArgs(1),
 	Short: "(re)Upload a back catalog of replays specified",
+	Long: `(re)Upload a back catalog of replays specified
+
+The optional filter is a glob pattern matched against replay file names,
+such as "Ever Dream*", and defaults to every replay. Only the replays of
+enabled toons, in the replay categories watched for them, are considered,
+which can be narrowed further by --toon.
+
+Replays which were already uploaded are skipped, unless --force is given,
+as are replays excluded by the "filters" rules in the configuration. Use
+--dry-run to see which rule (if any) decided each replay's fate.`,
+	Example: `  upload --since 2020-12-01
+  upload "*LE*" --toon 1-S2-1-1234567
+  upload --dry-run`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return errors.New("not yet implemented")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		force, _ := cmd.Flags().GetBool("force")
+
+		client, accountClients, err := newAPIClients()
+		if err != nil && !dryRun {
+			return err
+		}
+
+		filter, err := newReplayFilter(cmd, args)
+		if err != nil {
+			return err
+		}
+
+		filters, err := getUploadRules()
+		if err != nil {
+			return err
+		}
+
+		replaysRoot := viper.GetString("replaysRoot")
+		if f, err := os.Stat(replaysRoot); err != nil || !f.IsDir() {
+			return errors.New("replays root not configured correctly, please run the program once to locate it")
+		}
+
+		replays, err := findReplays(replaysRoot, filter)
+		if err != nil {
+			return err
+		}
+
+		if len(replays) == 0 {
+			golog.Warn("No replays matched the filter specified.")
+			return nil
+		}
+
+		if err = openLedger(); err != nil {
+			return err
+		}
+		defer closeLedger()
+
+		if dryRun {
+			replayUploader = uploader.New(nil, replayLedger)
+			replayUploader.SetRules(filters)
+
+			return explainUploads(replays, force)
+		}
+
+		golog.Infof("Uploading %d replays...", len(replays))
+		sc2api = client
+		replayUploader = uploader.New(sc2api, replayLedger)
+		replayUploader.SetAccountClients(accountClients)
+		replayUploader.SetRules(filters)
+		replayUploader.Subscribe(logUploadEvent)
+
+		if err = setUploadLimits(); err != nil {
+			return err
+		}
+
+		cancelOnInterrupt()
+
+		// queued all at once, to be uploaded by as many workers as allowed
+		done := make([]<-chan uploader.Event, len(replays))
+		for i, replay := range replays {
+			done[i] = replayUploader.EnqueueUpload(uploadCtx, replay, force)
+		}
+
+		var accepted, cancelled, duplicates, excluded, failed, skipped []string
+
+		for i, replay := range replays {
+			ev := <-done[i]
+
+			_, name, _ := utils.SplitFilepath(replay)
+			golog.Infof("[%d/%d] %s: %s", 1+i, len(replays), name, ev.Type)
+
+			switch ev.Type {
+			case uploader.EventSuccess:
+				accepted = append(accepted, name)
+			case uploader.EventDuplicate:
+				duplicates = append(duplicates, name)
+			case uploader.EventSkipped:
+				skipped = append(skipped, name)
+			case uploader.EventExcluded:
+				excluded = append(excluded, name)
+			default:
+				if errors.Is(ev.Err, context.Canceled) {
+					cancelled = append(cancelled, name)
+					continue
+				}
+
+				failed = append(failed, name)
+			}
+		}
+
+		if len(cancelled) > 0 {
+			golog.Warnf("Cancelled, %d replays were not uploaded.", len(cancelled))
+		}
+
+		line := strings.Repeat("=", termWidth/2)
+		fmt.Printf("\n%s\nAccepted:   %d\nDuplicates: %d\nSkipped:    %d\nExcluded:   %d\nFailed:     %d\n",
+			line, len(accepted), len(duplicates), len(skipped), len(excluded), len(failed))
+
+		for _, name := range failed {
+			fmt.Printf("  failed: %s\n", name)
+		}
+
+		fmt.Println(line)
+
+		if len(failed) > 0 {
+			return fmt.Errorf("%d replays failed to upload", len(failed))
+		}
+
+		return nil
 	},
 }
+
+// explainUploads prints what uploading the replays would do, and why
+func explainUploads(replays []string, force bool) error {
+	counts := make(map[uploader.EventType]int)
+
+	for _, replay := range replays {
+		ev := replayUploader.Check(replay, force)
+		counts[ev.Type]++
+
+		action := "upload"
+		switch ev.Type {
+		case uploader.EventSkipped:
+			action = "skip"
+		case uploader.EventExcluded:
+			action = "exclude"
+		case uploader.EventFailed:
+			action = "error"
+			ev.Reason = ev.Err.Error()
+		}
+
+		fmt.Printf("%-9s %s: %s\n", "["+action+"]", ev.MapName, ev.Reason)
+	}
+
+	line := strings.Repeat("=", termWidth/2)
+	fmt.Printf("\n%s\nWould upload: %d\nSkipped:      %d\nExcluded:     %d\n%s\n",
+		line, counts[uploader.EventQueued], counts[uploader.EventSkipped], counts[uploader.EventExcluded], line)
+
+	if counts[uploader.EventFailed] > 0 {
+		return fmt.Errorf("%d replays could not be checked", counts[uploader.EventFailed])
+	}
+
+	return nil
+}
+
+// replayFilter describes which replays of the back catalog should be uploaded
+type replayFilter struct {
+	Glob  string
+	Since time.Time
+	Until time.Time
+	Toons []string
+}
+
+func newReplayFilter(cmd *cobra.Command, args []string) (filter replayFilter, err error) {
+	filter.Glob = "*"
+	if len(args) > 0 {
+		filter.Glob = args[0]
+	}
+
+	if _, err = filepath.Match(filter.Glob, ""); err != nil {
+		return filter, fmt.Errorf("invalid filter: %v", err)
+	}
+
+	if filter.Toons, err = cmd.Flags().GetStringSlice("toon"); err != nil {
+		return
+	}
+
+	since, _ := cmd.Flags().GetString("since")
+	if filter.Since, err = parseFilterDate(since, false); err != nil {
+		return filter, fmt.Errorf("invalid --since: %v", err)
+	}
+
+	until, _ := cmd.Flags().GetString("until")
+	if filter.Until, err = parseFilterDate(until, true); err != nil {
+		return filter, fmt.Errorf("invalid --until: %v", err)
+	}
+
+	return filter, nil
+}
+
+// parseFilterDate accepts either a date or an RFC3339 timestamp; when only a
+// date is given and endOfDay is set, the whole of that day is included
+func parseFilterDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return t, err
+	}
+
+	if endOfDay {
+		t = t.Add(24*time.Hour - time.Nanosecond)
+	}
+
+	return t, nil
+}
+
+// matchToon returns whether the toon, in the format "AccountID/ToonID", is
+// one that was requested by the filter (or no toons were requested at all)
+func (filter replayFilter) matchToon(toon string) bool {
+	if len(filter.Toons) == 0 {
+		return true
+	}
+
+	for _, t := range filter.Toons {
+		if t == toon || strings.HasSuffix(toon, "/"+t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchReplay returns whether a replay file passes the glob and date filters
+func (filter replayFilter) matchReplay(info os.FileInfo) bool {
+	if info.IsDir() || !strings.HasSuffix(info.Name(), uploader.ReplayExt) {
+		return false
+	}
+
+	if ok, _ := filepath.Match(filter.Glob, info.Name()); !ok {
+		// also allow the extension to be omitted from the filter
+		if ok, _ = filepath.Match(filter.Glob, strings.TrimSuffix(info.Name(), uploader.ReplayExt)); !ok {
+			return false
+		}
+	}
+
+	if !filter.Since.IsZero() && info.ModTime().Before(filter.Since) {
+		return false
+	}
+
+	if !filter.Until.IsZero() && info.ModTime().After(filter.Until) {
+		return false
+	}
+
+	return true
+}
+
+// findReplays returns the paths of all replays of enabled toons, in the
+// categories watched for them, matching the given filter, oldest first, so
+// that they are uploaded in the order played
+func findReplays(replaysRoot string, filter replayFilter) ([]string, error) {
+	accs, err := sc2utils.EnumerateAccounts(replaysRoot)
+	if err != nil {
+		return nil, fmt.Errorf("findReplays: %v", err)
+	}
+
+	type replayFile struct {
+		Path    string
+		ModTime time.Time
+	}
+
+	found := make([]replayFile, 0)
+
+	for _, a := range accs {
+		toon := filepath.ToSlash(a.ID)
+		if !getToonEnabled(toon) || !filter.matchToon(toon) {
+			continue
+		}
+
+		for _, dir := range toonWatchPaths(replaysRoot, a) {
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				golog.Warnf("failed to list replays: %v: %v", dir, err)
+				continue
+			}
+
+			for _, f := range files {
+				if filter.matchReplay(f) {
+					found = append(found, replayFile{filepath.Join(dir, f.Name()), f.ModTime()})
+				}
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].ModTime.Before(found[j].ModTime)
+	})
+
+	paths := make([]string, len(found))
+	for i, f := range found {
+		paths[i] = f.Path
+	}
+
+	return paths, nil
+}
@@ -1,12 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
-	"strings"
-	"time"
+	"sync"
 
 	"fyne.io/fyne"
 	"fyne.io/fyne/container"
@@ -15,24 +15,31 @@ import (
 	"fyne.io/fyne/theme"
 	"fyne.io/fyne/widget"
 
-	"github.com/fsnotify/fsnotify"
+	"github.com/dustin/go-humanize"
 	"github.com/kataras/golog"
 	"github.com/spf13/viper"
 
 	"github.com/AlbinoGeek/sc2-rsu/cmd/gui"
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
 	"github.com/AlbinoGeek/sc2-rsu/fynex"
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
 	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
 	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
 	"github.com/AlbinoGeek/sc2-rsu/utils"
 )
 
 type windowMain struct {
 	*gui.WindowBase
+	accountWatcher *sc2utils.AccountWatcher
 	gettingStarted uint
 	modal          *widget.PopUp
+	enabledMu      sync.Mutex
 	uploadEnabled  map[string]bool
+	uploadMu       sync.Mutex
+	uploadRecords  map[string]*uploadRecord
 	uploadStatus   []*uploadRecord
-	watcher        *fsnotify.Watcher
+	watcher        fswatch.Watcher
 
 	nav    *fynex.NavDrawer
 	topbar *fynex.AppBar
@@ -50,10 +57,14 @@ type uploadRecord struct {
 	QueueID  string
 	ReplayID string
 	Status   string
+
+	// Progress is the fraction of the replay sent so far, from 0 to 1
+	Progress float64
 }
 
 func (main *windowMain) Init() {
 	main.uploadEnabled = make(map[string]bool)
+	main.uploadRecords = make(map[string]*uploadRecord)
 	main.uploadStatus = make([]*uploadRecord, 0)
 
 	w := main.App.NewWindow("SC2ReplayStats Uploader")
@@ -73,12 +84,43 @@ func (main *windowMain) Init() {
 			main.watcher.Close()
 		}
 
+		if main.accountWatcher != nil {
+			main.accountWatcher.Close()
+		}
+
+		cancelUploads()
+		replayUploader.Wait()
+		closeLedger()
+
 		w.Close()
 		main.App.Quit()
 	})
 
-	if sc2api == nil {
-		sc2api = sc2replaystats.New(viper.GetString("apikey"))
+	if key := viper.GetString("apikey"); sc2api == nil && key != "" {
+		sc2api = newAPIClient(key)
+	}
+
+	ledgerErr := openLedger()
+	if errors.Is(ledgerErr, ledger.ErrLocked) {
+		golog.Error(ledgerErr)
+	} else if ledgerErr != nil {
+		golog.Errorf("uploads will not be recorded: %v", ledgerErr)
+	} else {
+		main.loadUploadHistory()
+	}
+
+	replayUploader = uploader.New(sc2api, replayLedger)
+	replayUploader.Subscribe(main.onUploadEvent)
+	main.setupAccountClients()
+
+	if filters, err := getUploadRules(); err != nil {
+		golog.Errorf("upload filters ignored: %v", err)
+	} else {
+		replayUploader.SetRules(filters)
+	}
+
+	if err := setUploadLimits(); err != nil {
+		golog.Errorf("default upload limits used: %v", err)
 	}
 
 	main.accounts = makePaneAccounts(main).(*paneAccounts)
@@ -141,9 +183,22 @@ func (main *windowMain) Init() {
 	}
 
 	w.Show()
-
 	main.nav.Select(0) // Cannot select before window is shown!
+
+	// another instance is uploading the same replays, which this one must not
+	if errors.Is(ledgerErr, ledger.ErrLocked) {
+		d := dialog.NewError(ledgerErr, w)
+		d.SetOnClosed(main.App.Quit)
+		d.Show()
+
+		return
+	}
+
 	main.setupUploader()
+	replayUploader.Resume(uploadCtx)
+
+	go catchUp(main.watchPaths())
+	go catchUpOnWake(main.watchPaths)
 
 	if viper.GetString("version") == "" || viper.GetString("apikey") == "" {
 		main.openGettingStarted1()
@@ -214,72 +269,61 @@ func (main *windowMain) WizardModal(skipText, nextText string, skipFn, nextFn fu
 	box.Resize(size)
 }
 
-func (main *windowMain) handleReplay(replayFilename string) {
-	_, mapName, _ := utils.SplitFilepath(replayFilename)
-	entry := &uploadRecord{
-		Filename: replayFilename,
-		MapName:  mapName,
-		Status:   "pending",
+// loadUploadHistory fills the uploads list with the replays recorded in the
+// ledger, so that previous uploads are shown after a restart
+func (main *windowMain) loadUploadHistory() {
+	entries, err := replayLedger.List()
+	if err != nil {
+		golog.Errorf("failed to load upload history: %v", err)
+		return
 	}
 
-	golog.Debugf("uploading replay: %v", replayFilename)
-
-	main.uploadStatus = append(main.uploadStatus, entry)
-	main.uploads.Refresh()
-
-	tries := 0
-	wait := time.Second * 3
-
-	// naive retry logic
-	for {
-		tries++
-		if tries > 3 {
-			return
+	for _, e := range entries {
+		if e.Unfinished() {
+			continue // will be shown again when resumed
 		}
 
-		// wait for the replay to have finished being written (large enough filesize)
-		var lastSize int64
-
-		for {
-			time.Sleep(time.Millisecond * 250)
-
-			// ! smallest replay I've seen is 27418 bytes (-3 second long)
-			if s, err := os.Stat(replayFilename); err == nil && s.Size() > validReplaySize {
-				// check that the replay has stopped growing
-				if s.Size() > lastSize {
-					lastSize = s.Size()
-				} else {
-					break
-				}
-			}
+		entry := &uploadRecord{
+			Filename: e.Filename,
+			QueueID:  e.QueueID,
+			ReplayID: e.ReplayID,
+			Status:   string(e.Status),
 		}
 
-		entry.Status = "uploading"
-
-		main.uploads.Refresh()
+		_, entry.MapName, _ = utils.SplitFilepath(e.Filename)
+		if s, err := os.Stat(e.Filename); err == nil {
+			entry.Filesize = humanize.Bytes(uint64(s.Size()))
+		}
 
-		rqid, err := sc2api.UploadReplay(replayFilename)
-		entry.QueueID = rqid
+		if e.QueueID != "" {
+			entry.Progress = 1 // it was sent, whatever happened next
+		}
 
-		if err != nil {
-			entry.Status = "u failed"
+		main.uploadMu.Lock()
+		main.uploadStatus = append(main.uploadStatus, entry)
+		main.uploadMu.Unlock()
+	}
+}
 
-			main.uploads.Refresh()
+// uploadCount returns how many replays are in the uploads list
+func (main *windowMain) uploadCount() int {
+	main.uploadMu.Lock()
+	defer main.uploadMu.Unlock()
 
-			dialog.NewError(fmt.Errorf("replay upload failed:%v\n%v", mapName, err), main.GetWindow())
-		} else {
-			entry.Status = "processing"
+	return len(main.uploadStatus)
+}
 
-			main.uploads.Refresh()
+// uploadRow returns a copy of the row of the uploads list given, as its
+// record keeps changing while uploading, and whether there is such a row
+func (main *windowMain) uploadRow(row int) (uploadRecord, bool) {
+	main.uploadMu.Lock()
+	defer main.uploadMu.Unlock()
 
-			if err := main.watchReplayStatus(entry); err == nil {
-				return
-			}
-		}
-
-		time.Sleep(wait)
-		wait *= 2
+	if row < 0 || row >= len(main.uploadStatus) {
+		return uploadRecord{}, false
 	}
+
+	return *main.uploadStatus[row], true
 }
 
 // OpenGitHub launches the user's browser to a given GitHub URL relative to
@@ -330,13 +374,7 @@ func (main *windowMain) setupUploader() {
 		dialog.NewError(err, w)
 	}
 
-	paths := make([]string, 0)
-
-	for _, a := range accs {
-		if getToonEnabled(a) {
-			paths = append(paths, filepath.Join(replaysRoot, a, "Replays", "Multiplayer"))
-		}
-	}
+	paths := watchPaths(replaysRoot, accs)
 
 	// TODO : should just clear watch paths instead of making a new watcher
 	// in case we were setup again (replaysRoot changed)
@@ -353,52 +391,118 @@ func (main *windowMain) setupUploader() {
 
 	main.watcher = watch
 
-	go func() {
-		for {
-			select {
-			case event, ok := <-watch.Events:
-				if !ok {
-					return
-				}
+	go watchReplays(watch, handleReplay)
 
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					// bug: SC2 sometime writes out ".SC2Replay.writeCacheBackup" files
-					if strings.HasSuffix(event.Name, "eplay") {
-						go main.handleReplay(event.Name)
-					}
-				}
-			case err, ok := <-watch.Errors:
-				if !ok {
-					return
-				}
+	if main.accountWatcher != nil {
+		main.accountWatcher.Close()
+	}
+
+	if main.accountWatcher, err = watchAccounts(replaysRoot, main.addToon); err != nil {
+		golog.Warnf("new toons will not be found until restarted: %v", err)
+	}
+}
 
-				golog.Warnf("fswatcher error: %v", err)
+// addToon watches the replay directories created for a toon found while
+// running, if it is enabled, and has it shown in the Accounts pane
+func (main *windowMain) addToon(found sc2utils.Toon) {
+	id := filepath.ToSlash(found.ID)
+
+	main.enabledMu.Lock()
+	enabled, ok := main.uploadEnabled[id]
+	main.enabledMu.Unlock()
+
+	if !ok {
+		golog.Infof("Found new toon: %v", id)
+		enabled = getToonEnabled(id)
+	}
+
+	if enabled && main.watcher != nil {
+		for _, p := range toonWatchPaths(viper.GetString("replaysRoot"), found) {
+			if err := watchReplayPath(main.watcher, p, handleReplay); err != nil {
+				golog.Error(err)
 			}
 		}
-	}()
+	}
+
+	main.accounts.RequestUpdate()
+}
+
+// isUploadEnabled returns whether the replays of a toon are uploaded
+func (main *windowMain) isUploadEnabled(id string) bool {
+	main.enabledMu.Lock()
+	defer main.enabledMu.Unlock()
+
+	return main.uploadEnabled[id]
+}
+
+// setUploadEnabled records whether the replays of a toon are uploaded
+func (main *windowMain) setUploadEnabled(id string, enabled bool) {
+	main.enabledMu.Lock()
+	defer main.enabledMu.Unlock()
+
+	main.uploadEnabled[id] = enabled
+}
+
+// watchPaths returns the replay directories watched for the toons enabled
+func (main *windowMain) watchPaths() []string {
+	replaysRoot := viper.GetString("replaysRoot")
+	if replaysRoot == "" {
+		return nil
+	}
+
+	toons, err := sc2utils.EnumerateAccounts(replaysRoot)
+	if err != nil {
+		golog.Errorf("failed to find toons: %v", err)
+		return nil
+	}
+
+	return watchPaths(replaysRoot, toons)
 }
 
-func (main *windowMain) toggleUploading(btn *widget.Button, id string) func() {
+// setupAccountClients has the replays of accounts given their own API key
+// uploaded with it
+func (main *windowMain) setupAccountClients() {
+	accountKeys, err := getAccountAPIKeys()
+	if err != nil {
+		golog.Errorf("accounts will use the default API key: %v", err)
+		return
+	}
+
+	clients := make(map[string]*sc2replaystats.Client)
+	for acc, key := range accountKeys {
+		clients[acc] = newAPIClient(key)
+	}
+
+	replayUploader.SetAccountClients(clients)
+}
+
+func (main *windowMain) toggleUploading(btn *widget.Button, toon sc2utils.Toon) func() {
 	return func() {
 		w := main.GetWindow()
-		replaysRoot := viper.GetString("replaysRoot")
+		id := filepath.ToSlash(toon.ID)
+		paths := toonWatchPaths(viper.GetString("replaysRoot"), toon)
 
-		main.uploadEnabled[id] = !main.uploadEnabled[id]
+		enabled := !main.isUploadEnabled(id)
+		main.setUploadEnabled(id, enabled)
 
-		if main.uploadEnabled[id] {
-			if err := main.watcher.Add(filepath.Join(replaysRoot, id, "Replays", "Multiplayer")); err != nil {
-				dialog.NewError(err, w)
+		if enabled {
+			for _, p := range paths {
+				if err := main.watcher.Add(p); err != nil {
+					dialog.NewError(err, w)
 
-				return
+					return
+				}
 			}
 
 			btn.Importance = widget.HighImportance
 			btn.Icon = theme.MediaPauseIcon()
 		} else {
-			if err := main.watcher.Remove(filepath.Join(replaysRoot, id, "Replays", "Multiplayer")); err != nil {
-				dialog.NewError(err, w)
+			for _, p := range paths {
+				if err := main.watcher.Remove(p); err != nil {
+					dialog.NewError(err, w)
 
-				return
+					return
+				}
 			}
 
 			btn.Importance = widget.MediumImportance
@@ -409,40 +513,108 @@ func (main *windowMain) toggleUploading(btn *widget.Button, id string) func() {
 	}
 }
 
+// toggleCategory starts or stops uploading the replays of a category (such
+// as "VersusAI") for a toon
+func (main *windowMain) toggleCategory(toon sc2utils.Toon, category string) func(bool) {
+	return func(watch bool) {
+		w := main.GetWindow()
+		categories := make([]string, 0)
+
+		for _, c := range getToonCategories(toon.ID) {
+			if c != category {
+				categories = append(categories, c)
+			}
+		}
+
+		if watch {
+			categories = append(categories, category)
+		}
+
+		// the watcher only watches the categories of toons enabled
+		if main.isUploadEnabled(filepath.ToSlash(toon.ID)) && main.watcher != nil {
+			p := toonReplaysPath(viper.GetString("replaysRoot"), toon.ID, category)
+
+			var err error
+			if watch {
+				err = main.watcher.Add(p)
+			} else {
+				err = main.watcher.Remove(p)
+			}
+
+			if err != nil {
+				dialog.NewError(err, w)
+				return
+			}
+		}
+
+		if err := setToonCategories(toon.ID, categories); err != nil {
+			dialog.NewError(err, w)
+		}
+	}
+}
+
 func (main *windowMain) updateEnabledToons() {
 	enabledToons := make([]string, 0)
 
+	main.enabledMu.Lock()
 	for key, enabled := range main.uploadEnabled {
 		if enabled {
 			enabledToons = append(enabledToons, key)
 		}
 	}
+	main.enabledMu.Unlock()
 
 	setToons(enabledToons)
 }
 
-func (main *windowMain) watchReplayStatus(entry *uploadRecord) error {
+// onUploadEvent shows the progress of replays being uploaded in the uploads
+// list, adding a row for every replay newly queued
+func (main *windowMain) onUploadEvent(ev uploader.Event) {
 	defer main.uploads.Refresh()
 
-	for {
-		time.Sleep(time.Second)
+	main.uploadMu.Lock()
+	defer main.uploadMu.Unlock()
 
-		rid, err := sc2api.GetReplayStatus(entry.QueueID)
+	entry, ok := main.uploadRecords[ev.Filename]
+	if ev.Type == uploader.EventQueued || !ok {
+		entry = &uploadRecord{
+			Filename: ev.Filename,
+			MapName:  ev.MapName,
+		}
 
-		if err != nil {
-			golog.Errorf("error checking reply status: %v: %v", entry.QueueID, err)
-			entry.Status = "p failed"
+		main.uploadRecords[ev.Filename] = entry
+		main.uploadStatus = append(main.uploadStatus, entry)
+	}
 
-			return err // could not check status
-		}
+	switch {
+	case ev.Type != uploader.EventProgress:
+		entry.Status = ev.Type.String()
+	case ev.Polls > 0:
+		entry.Status = fmt.Sprintf("processing (%d)", ev.Polls)
+	case ev.Total > 0:
+		entry.Progress = float64(ev.Sent) / float64(ev.Total)
+	}
 
-		if rid != "" {
-			entry.Status = "success"
-			entry.ReplayID = rid
+	switch ev.Type {
+	case uploader.EventUploading:
+		entry.Progress = 0
+	case uploader.EventProcessing:
+		entry.Progress = 1
+	}
 
-			return nil // replay parsed!
-		}
+	if ev.Size > 0 {
+		entry.Filesize = humanize.Bytes(uint64(ev.Size))
+	}
+
+	if ev.QueueID != "" {
+		entry.QueueID = ev.QueueID
+	}
+
+	if ev.ReplayID != "" {
+		entry.ReplayID = ev.ReplayID
+	}
 
-		golog.Debugf("sc2replaystats process..: [%v] %s", entry.QueueID, rid)
+	if ev.Err != nil {
+		golog.Errorf("failed to upload replay: %v: %v", ev.MapName, describeAPIError(ev.Err))
 	}
 }
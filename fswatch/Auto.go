@@ -0,0 +1,175 @@
+package fswatch
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kataras/golog"
+)
+
+// Auto is a Watcher using notifications for the directories where they work,
+// and polling the others: those on network filesystems, those which could
+// not be watched with notifications, or all of them if notifications are not
+// available at all
+type Auto struct {
+	closed chan struct{}
+	done   chan struct{}
+	errors chan error
+	events chan Event
+	mu     sync.Mutex
+	notify *Notify
+	once   sync.Once
+	poll   *Poll
+	polled map[string]bool
+	wg     sync.WaitGroup
+}
+
+// NewAuto returns an Auto watcher, polling directories every interval
+func NewAuto(interval time.Duration) *Auto {
+	a := &Auto{
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		errors: make(chan error),
+		events: make(chan Event),
+		poll:   NewPoll(interval),
+		polled: make(map[string]bool),
+	}
+
+	n, err := NewNotify()
+	if err != nil {
+		golog.Warnf("%v, polling directories every %v instead", err, interval)
+	} else {
+		a.notify = n
+		a.forward(n)
+	}
+
+	a.forward(a.poll)
+
+	go func() {
+		a.wg.Wait()
+		close(a.errors)
+		close(a.events)
+		close(a.done)
+	}()
+
+	return a
+}
+
+// Add starts watching a directory, with notifications if possible
+func (a *Auto) Add(dir string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.notify != nil && !Remote(dir) {
+		err := a.notify.Add(dir)
+		if err == nil {
+			return nil
+		}
+
+		if _, statErr := os.Stat(dir); statErr != nil {
+			return err
+		}
+
+		golog.Warnf("cannot be notified of changes to %v (%v), polling it instead", dir, err)
+	} else if a.notify != nil {
+		golog.Infof("polling %v, which is on a network filesystem", dir)
+	}
+
+	if err := a.poll.Add(dir); err != nil {
+		return err
+	}
+
+	a.polled[dir] = true
+
+	return nil
+}
+
+// Remove stops watching a directory
+func (a *Auto) Remove(dir string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.polled[dir] {
+		delete(a.polled, dir)
+		return a.poll.Remove(dir)
+	}
+
+	if a.notify == nil {
+		return fmt.Errorf("%w: %v", ErrNotWatched, dir)
+	}
+
+	return a.notify.Remove(dir)
+}
+
+// Close stops watching every directory
+func (a *Auto) Close() error {
+	var err error
+
+	a.once.Do(func() {
+		close(a.closed)
+
+		if a.notify != nil {
+			err = a.notify.Close()
+		}
+
+		a.poll.Close()
+		<-a.done
+	})
+
+	return err
+}
+
+// Events receives what happens to the files in the directories watched
+func (a *Auto) Events() <-chan Event {
+	return a.events
+}
+
+// Errors receives any errors encountered while watching
+func (a *Auto) Errors() <-chan error {
+	return a.errors
+}
+
+// Polled returns whether a directory is polled rather than notified of
+func (a *Auto) Polled(dir string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.polled[dir]
+}
+
+// forward passes the events and errors of w on, until it is closed
+func (a *Auto) forward(w Watcher) {
+	a.wg.Add(1)
+
+	go func() {
+		defer a.wg.Done()
+
+		events, errors := w.Events(), w.Errors()
+		for events != nil || errors != nil {
+			select {
+			case ev, ok := <-events:
+				if !ok {
+					events = nil
+					continue
+				}
+
+				select {
+				case a.events <- ev:
+				case <-a.closed:
+				}
+			case err, ok := <-errors:
+				if !ok {
+					errors = nil
+					continue
+				}
+
+				select {
+				case a.errors <- err:
+				case <-a.closed:
+				}
+			}
+		}
+	}()
+}
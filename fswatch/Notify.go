@@ -0,0 +1,130 @@
+package fswatch
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Notify is a Watcher relying on the operating system to be notified of
+// changes (inotify, kqueue, ReadDirectoryChangesW), which is immediate but
+// does not work everywhere
+type Notify struct {
+	closed chan struct{}
+	done   chan struct{}
+	errors chan error
+	events chan Event
+	once   sync.Once
+	w      *fsnotify.Watcher
+}
+
+// NewNotify returns a Notify watcher, or an error if notifications are not
+// available, such as when too many files are watched already
+func NewNotify() (*Notify, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup fswatcher: %v", err)
+	}
+
+	n := &Notify{
+		closed: make(chan struct{}),
+		done:   make(chan struct{}),
+		errors: make(chan error),
+		events: make(chan Event),
+		w:      w,
+	}
+
+	go n.run()
+
+	return n, nil
+}
+
+// Add starts watching a directory
+func (n *Notify) Add(dir string) error {
+	return n.w.Add(dir)
+}
+
+// Remove stops watching a directory
+func (n *Notify) Remove(dir string) error {
+	if err := n.w.Remove(dir); err != nil {
+		return fmt.Errorf("%w: %v: %v", ErrNotWatched, dir, err)
+	}
+
+	return nil
+}
+
+// Close stops watching every directory
+func (n *Notify) Close() error {
+	var err error
+
+	n.once.Do(func() {
+		close(n.closed)
+		err = n.w.Close()
+		<-n.done
+	})
+
+	return err
+}
+
+// Events receives what happens to the files in the directories watched
+func (n *Notify) Events() <-chan Event {
+	return n.events
+}
+
+// Errors receives any errors encountered while watching
+func (n *Notify) Errors() <-chan error {
+	return n.errors
+}
+
+func (n *Notify) run() {
+	defer close(n.done)
+	defer close(n.errors)
+	defer close(n.events)
+
+	for {
+		select {
+		case ev, ok := <-n.w.Events:
+			if !ok {
+				return
+			}
+
+			var op Op
+
+			switch {
+			case ev.Op&fsnotify.Create == fsnotify.Create:
+				op = Create
+			case ev.Op&fsnotify.Write == fsnotify.Write:
+				op = Write
+			case ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0:
+				op = Remove
+			default:
+				continue // chmod
+			}
+
+			if !n.send(Event{Name: ev.Name, Op: op}) {
+				return
+			}
+		case err, ok := <-n.w.Errors:
+			if !ok {
+				return
+			}
+
+			select {
+			case n.errors <- err:
+			case <-n.closed:
+				return
+			}
+		}
+	}
+}
+
+// send passes an event on, unless closed while nobody was receiving events
+func (n *Notify) send(ev Event) bool {
+	select {
+	case n.events <- ev:
+		return true
+	case <-n.closed:
+		return false
+	}
+}
@@ -0,0 +1,249 @@
+package fswatch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fileState is what Poll remembers of a file, to tell whether it changed
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Poll is a Watcher listing the directories watched every interval, and
+// comparing the size and modification time of their files with those seen
+// before, which works everywhere but is neither immediate nor cheap
+//
+// A directory which cannot be listed, such as one removed, is reported once
+// to Errors, and then kept watched quietly until it can be listed again.
+type Poll struct {
+	closed   chan struct{}
+	dirs     map[string]map[string]fileState
+	done     chan struct{}
+	failed   map[string]bool
+	errors   chan error
+	events   chan Event
+	interval time.Duration
+	mu       sync.Mutex
+	once     sync.Once
+}
+
+// NewPoll returns a Poll watcher, listing directories every interval
+func NewPoll(interval time.Duration) *Poll {
+	p := &Poll{
+		closed:   make(chan struct{}),
+		dirs:     make(map[string]map[string]fileState),
+		done:     make(chan struct{}),
+		failed:   make(map[string]bool),
+		errors:   make(chan error),
+		events:   make(chan Event),
+		interval: interval,
+	}
+
+	go p.run()
+
+	return p
+}
+
+// Add starts watching a directory, whose files are only reported once they
+// change from how they are now
+func (p *Poll) Add(dir string) error {
+	files, err := list(dir)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.dirs[dir]; !ok {
+		p.dirs[dir] = files
+	}
+
+	return nil
+}
+
+// Remove stops watching a directory
+func (p *Poll) Remove(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.dirs[dir]; !ok {
+		return fmt.Errorf("%w: %v", ErrNotWatched, dir)
+	}
+
+	delete(p.dirs, dir)
+	delete(p.failed, dir)
+
+	return nil
+}
+
+// Close stops watching every directory
+func (p *Poll) Close() error {
+	p.once.Do(func() {
+		close(p.closed)
+		<-p.done
+	})
+
+	return nil
+}
+
+// Events receives what happens to the files in the directories watched
+func (p *Poll) Events() <-chan Event {
+	return p.events
+}
+
+// Errors receives any errors encountered while watching
+func (p *Poll) Errors() <-chan error {
+	return p.errors
+}
+
+func (p *Poll) run() {
+	defer close(p.done)
+	defer close(p.errors)
+	defer close(p.events)
+
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-p.closed:
+			return
+		case <-t.C:
+			if !p.poll() {
+				return
+			}
+		}
+	}
+}
+
+// poll lists every directory watched and reports what changed, returning
+// false once closed
+func (p *Poll) poll() bool {
+	p.mu.Lock()
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	p.mu.Unlock()
+
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		files, err := list(dir)
+		if err != nil {
+			p.mu.Lock()
+			_, ok := p.dirs[dir]
+			reported := p.failed[dir]
+			if ok {
+				p.failed[dir] = true
+			}
+			p.mu.Unlock()
+
+			if ok && !reported && !p.sendError(err) {
+				return false
+			}
+
+			continue
+		}
+
+		p.mu.Lock()
+		before, ok := p.dirs[dir]
+		if ok {
+			p.dirs[dir] = files
+			delete(p.failed, dir)
+		}
+		p.mu.Unlock()
+
+		if !ok {
+			continue // removed meanwhile
+		}
+
+		for _, ev := range diff(dir, before, files) {
+			if !p.sendEvent(ev) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// sendEvent passes an event on, unless closed while nobody was receiving
+// events
+func (p *Poll) sendEvent(ev Event) bool {
+	select {
+	case p.events <- ev:
+		return true
+	case <-p.closed:
+		return false
+	}
+}
+
+// sendError passes an error on, unless closed while nobody was receiving
+// errors
+func (p *Poll) sendError(err error) bool {
+	select {
+	case p.errors <- err:
+		return true
+	case <-p.closed:
+		return false
+	}
+}
+
+// diff returns what changed between two listings of a directory, in order
+// of file name
+func diff(dir string, before, after map[string]fileState) []Event {
+	events := make([]Event, 0)
+
+	for name, s := range after {
+		if old, ok := before[name]; !ok {
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Create})
+		} else if old.size != s.size || !old.modTime.Equal(s.modTime) {
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Write})
+		}
+	}
+
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			events = append(events, Event{Name: filepath.Join(dir, name), Op: Remove})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Name < events[j].Name
+	})
+
+	return events
+}
+
+// list returns the state of every file in a directory
+func list(dir string) (map[string]fileState, error) {
+	s, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.IsDir() {
+		return nil, fmt.Errorf("not a directory: %v", dir)
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]fileState, len(infos))
+	for _, f := range infos {
+		files[f.Name()] = fileState{modTime: f.ModTime(), size: f.Size()}
+	}
+
+	return files, nil
+}
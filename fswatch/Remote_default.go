@@ -0,0 +1,9 @@
+// +build !linux
+
+package fswatch
+
+// Remote returns whether a directory is on a network filesystem, for which
+// change notifications are not delivered; it is only known on Linux
+func Remote(dir string) bool {
+	return false
+}
@@ -0,0 +1,30 @@
+package fswatch
+
+import "syscall"
+
+// remoteMagic are the statfs(2) types of network filesystems, which do not
+// deliver inotify events for changes made by other computers (or, for 9p,
+// by Windows when running under WSL)
+var remoteMagic = map[uint32]string{
+	0x6969:     "nfs",
+	0x517b:     "smb",
+	0xff534d42: "cifs",
+	0xfe534d42: "smb2",
+	0x01021997: "9p",
+	0x5346414f: "afs",
+	0x73757245: "coda",
+	0x00c36400: "ceph",
+}
+
+// Remote returns whether a directory is on a network filesystem, for which
+// change notifications are not delivered
+func Remote(dir string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return false
+	}
+
+	_, remote := remoteMagic[uint32(st.Type)]
+
+	return remote
+}
@@ -0,0 +1,64 @@
+// Package fswatch reports files created, written and removed in directories,
+// either as the operating system notifies of them (see Notify), by polling
+// (see Poll), or by choosing between both for each directory (see Auto), as
+// notifications are not delivered for network shares and some filesystems.
+package fswatch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Op is what happened to a file
+type Op uint8
+
+// All of the operations reported
+const (
+	Create Op = iota + 1
+	Write
+	Remove
+)
+
+var opNames = map[Op]string{
+	Create: "create",
+	Write:  "write",
+	Remove: "remove",
+}
+
+func (op Op) String() string {
+	return opNames[op]
+}
+
+// Event is a file (or directory) which was created, written or removed
+type Event struct {
+	Name string
+	Op   Op
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%s: %s", e.Op, e.Name)
+}
+
+// ErrNotWatched is returned by Remove for a directory which is not watched
+var ErrNotWatched = errors.New("directory is not watched")
+
+// Watcher reports what happens to the files in the directories added to it
+// (not including their subdirectories), until it is closed, at which point
+// both of its channels are closed
+type Watcher interface {
+	// Add starts watching a directory
+	Add(dir string) error
+
+	// Remove stops watching a directory
+	Remove(dir string) error
+
+	// Close stops watching every directory
+	Close() error
+
+	// Events receives what happens to the files in the directories watched
+	Events() <-chan Event
+
+	// Errors receives any errors encountered while watching, which do not
+	// stop the Watcher
+	Errors() <-chan error
+}
@@ -0,0 +1,126 @@
+package fswatch_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
+)
+
+// next waits for op to be reported for name, skipping any other events, or
+// fails the test if it is not in time
+func next(t *testing.T, w fswatch.Watcher, name string, op fswatch.Op) {
+	timeout := time.After(5 * time.Second)
+
+	for {
+		select {
+		case ev := <-w.Events():
+			if ev.Name == name && ev.Op == op {
+				return
+			}
+		case err := <-w.Errors():
+			t.Fatalf("must not error: %v", err)
+		case <-timeout:
+			t.Fatalf("no %v event for %v", op, name)
+		}
+	}
+}
+
+func testWatcher(t *testing.T, w fswatch.Watcher) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "test.SC2Replay")
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "before.SC2Replay"), []byte("x"), 0644), "must not error")
+	assert.Nil(t, w.Add(dir), "must not error")
+	assert.NotNil(t, w.Add(filepath.Join(dir, "missing")), "missing directories must not be watched")
+
+	assert.Nil(t, ioutil.WriteFile(name, []byte("x"), 0644), "must not error")
+	next(t, w, name, fswatch.Create)
+
+	assert.Nil(t, ioutil.WriteFile(name, []byte("xyz"), 0644), "must not error")
+	next(t, w, name, fswatch.Write)
+
+	assert.Nil(t, os.Remove(name), "must not error")
+	next(t, w, name, fswatch.Remove)
+
+	assert.Nil(t, w.Remove(dir), "must not error")
+	assert.True(t, errors.Is(w.Remove(dir), fswatch.ErrNotWatched), "directories must not be removed twice")
+
+	assert.Nil(t, w.Close(), "must not error")
+
+	_, ok := <-w.Events()
+	assert.False(t, ok, "events must be closed")
+}
+
+func TestPoll(t *testing.T) {
+	testWatcher(t, fswatch.NewPoll(10*time.Millisecond))
+}
+
+func TestPollRemovedDir(t *testing.T) {
+	w := fswatch.NewPoll(time.Millisecond)
+	defer w.Close()
+
+	dir := filepath.Join(t.TempDir(), "Multiplayer")
+	assert.Nil(t, os.Mkdir(dir, 0755), "must not error")
+	assert.Nil(t, w.Add(dir), "must not error")
+	assert.Nil(t, os.Remove(dir), "must not error")
+
+	select {
+	case err := <-w.Errors():
+		assert.NotNil(t, err, "removed directories must be reported")
+	case <-time.After(5 * time.Second):
+		t.Fatal("removed directories must be reported")
+	}
+
+	select {
+	case err := <-w.Errors():
+		t.Fatalf("removed directories must only be reported once: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// ...and watched again once they reappear
+	name := filepath.Join(dir, "test.SC2Replay")
+	assert.Nil(t, os.Mkdir(dir, 0755), "must not error")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("x"), 0644), "must not error")
+	next(t, w, name, fswatch.Create)
+}
+
+func TestNotify(t *testing.T) {
+	w, err := fswatch.NewNotify()
+	if err != nil {
+		t.Skipf("notifications unavailable: %v", err)
+	}
+
+	testWatcher(t, w)
+}
+
+func TestAuto(t *testing.T) {
+	testWatcher(t, fswatch.NewAuto(10*time.Millisecond))
+}
+
+func TestCloseUnread(t *testing.T) {
+	w := fswatch.NewAuto(time.Millisecond)
+	dir := t.TempDir()
+
+	assert.Nil(t, w.Add(dir), "must not error")
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "a"), []byte("x"), 0644), "must not error")
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		w.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("must close while events are not read")
+	}
+}
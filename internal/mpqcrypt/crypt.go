@@ -0,0 +1,69 @@
+// Package mpqcrypt holds the hashing and encryption of MPQ archives, shared by
+// the reader (package mpq) and the writer the tests use (package mpqtest).
+package mpqcrypt
+
+import "strings"
+
+// hash types understood by HashString
+const (
+	HashTableOffset = 0
+	HashA           = 1
+	HashB           = 2
+	HashTable       = 3
+)
+
+var cryptTable = func() (table [0x500]uint32) {
+	seed := uint32(0x00100001)
+
+	for i := 0; i < 0x100; i++ {
+		for j, index := 0, i; j < 5; j, index = j+1, index+0x100 {
+			seed = (seed*125 + 3) % 0x2AAAAB
+			hi := (seed & 0xFFFF) << 0x10
+
+			seed = (seed*125 + 3) % 0x2AAAAB
+			lo := seed & 0xFFFF
+
+			table[index] = hi | lo
+		}
+	}
+
+	return
+}()
+
+// HashString is the MPQ "one-way" hash of a file name or encryption key
+func HashString(str string, hashType uint32) uint32 {
+	seed1, seed2 := uint32(0x7FED7FED), uint32(0xEEEEEEEE)
+
+	for _, ch := range []byte(strings.ToUpper(str)) {
+		value := cryptTable[hashType<<8+uint32(ch)]
+		seed1 = value ^ (seed1 + seed2)
+		seed2 = uint32(ch) + seed1 + seed2 + seed2<<5 + 3
+	}
+
+	return seed1
+}
+
+// Decrypt decrypts the given block of uint32s in place
+func Decrypt(data []uint32, key uint32) {
+	seed := uint32(0xEEEEEEEE)
+
+	for i, value := range data {
+		seed += cryptTable[0x400+key&0xFF]
+		value ^= key + seed
+		key = (^key<<0x15 + 0x11111111) | key>>0x0B
+		seed = value + seed + seed<<5 + 3
+		data[i] = value
+	}
+}
+
+// Encrypt encrypts the given block of uint32s in place
+func Encrypt(data []uint32, key uint32) {
+	seed := uint32(0xEEEEEEEE)
+
+	for i, value := range data {
+		seed += cryptTable[0x400+key&0xFF]
+		data[i] = value ^ (key + seed)
+		key = (^key<<0x15 + 0x11111111) | key>>0x0B
+		seed = value + seed + seed<<5 + 3
+	}
+}
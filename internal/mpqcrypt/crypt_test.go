@@ -0,0 +1,24 @@
+package mpqcrypt_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqcrypt"
+)
+
+func TestHashString(t *testing.T) {
+	var cases = []struct {
+		Str    string
+		Type   uint32
+		Result uint32
+	}{
+		{"(hash table)", mpqcrypt.HashTable, 0xC3AF3770},
+		{"(block table)", mpqcrypt.HashTable, 0xEC83B3A3},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Result, mpqcrypt.HashString(c.Str, c.Type), "hash must match: %v", c.Str)
+	}
+}
@@ -0,0 +1,174 @@
+// Package mpqtest writes MPQ archives, for tests of the packages reading them
+// (mpq, sc2replay) to build archives with, rather than for production use.
+package mpqtest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqcrypt"
+	"github.com/AlbinoGeek/sc2-rsu/mpq"
+)
+
+// the parts of the MPQ format the writer needs, as the reader keeps them
+// unexported
+const (
+	compressionZlib = 0x02
+	flagCompress    = 0x00000200
+	flagSingleUnit  = 0x01000000
+	flagExists      = 0x80000000
+)
+
+var (
+	magicHeader   = [4]byte{'M', 'P', 'Q', 0x1A}
+	magicUserData = [4]byte{'M', 'P', 'Q', 0x1B}
+)
+
+// File is a file to be stored in an MPQ archive by Write
+type File struct {
+	Name string
+	Data []byte
+
+	// SingleUnit stores the file in one piece instead of in sectors
+	SingleUnit bool
+}
+
+// userDataAlign is the alignment of the MPQ header following user data
+const userDataAlign = 0x400
+
+// Write writes an MPQ archive containing the given files to w, preceded by
+// userData unless it is nil. Files are zlib compressed where that helps.
+func Write(w io.Writer, userData []byte, files []File) error {
+	var out bytes.Buffer
+
+	if userData != nil {
+		offset := (16 + len(userData) + userDataAlign - 1) / userDataAlign * userDataAlign
+
+		binary.Write(&out, binary.LittleEndian, []uint32{
+			binary.LittleEndian.Uint32(magicUserData[:]),
+			uint32(offset - 16),
+			uint32(offset),
+			uint32(len(userData)),
+		})
+		out.Write(userData)
+		out.Write(make([]byte, offset-out.Len()))
+	}
+
+	offset := out.Len()
+	// laid out as StarCraft II does, in format 4
+	header := mpq.Header{
+		Magic:             magicHeader,
+		HeaderSize:        0xD0,
+		FormatVersion:     3,
+		SectorSizeShift:   3,
+		HashTableEntries:  16,
+		BlockTableEntries: uint32(len(files)),
+	}
+
+	for header.HashTableEntries < 2*uint32(len(files)) {
+		header.HashTableEntries *= 2
+	}
+
+	sectorSize := 512 << header.SectorSizeShift
+
+	// file data follows the header, and is followed by the tables
+	var data bytes.Buffer
+
+	blocks := make([]uint32, 0, 4*len(files))
+
+	for _, f := range files {
+		start := int(header.HeaderSize) + data.Len()
+		flags := uint32(flagExists | flagCompress)
+
+		if f.SingleUnit {
+			flags |= flagSingleUnit
+			data.Write(compress(f.Data))
+		} else {
+			var sectors [][]byte
+			for i := 0; i < len(f.Data); i += sectorSize {
+				end := i + sectorSize
+				if end > len(f.Data) {
+					end = len(f.Data)
+				}
+
+				sectors = append(sectors, compress(f.Data[i:end]))
+			}
+
+			pos := uint32(4 * (len(sectors) + 1))
+			positions := []uint32{pos}
+
+			for _, s := range sectors {
+				pos += uint32(len(s))
+				positions = append(positions, pos)
+			}
+
+			binary.Write(&data, binary.LittleEndian, positions)
+
+			for _, s := range sectors {
+				data.Write(s)
+			}
+		}
+
+		size := int(header.HeaderSize) + data.Len() - start
+		blocks = append(blocks, uint32(start), uint32(size), uint32(len(f.Data)), flags)
+	}
+
+	hashes := make([]uint32, 4*header.HashTableEntries)
+	for i := range hashes {
+		hashes[i] = 0xFFFFFFFF
+	}
+
+	for i, f := range files {
+		n := header.HashTableEntries
+		slot := mpqcrypt.HashString(f.Name, mpqcrypt.HashTableOffset) % n
+
+		for hashes[4*slot+3] != 0xFFFFFFFF {
+			slot = (slot + 1) % n
+		}
+
+		copy(hashes[4*slot:], []uint32{
+			mpqcrypt.HashString(f.Name, mpqcrypt.HashA),
+			mpqcrypt.HashString(f.Name, mpqcrypt.HashB),
+			0, // locale neutral, any platform
+			uint32(i),
+		})
+	}
+
+	header.HashTableOffset = header.HeaderSize + uint32(data.Len())
+	header.BlockTableOffset = header.HashTableOffset + uint32(4*len(hashes))
+	header.ArchiveSize = header.BlockTableOffset + uint32(4*len(blocks))
+
+	mpqcrypt.Encrypt(hashes, mpqcrypt.HashString("(hash table)", mpqcrypt.HashTable))
+	mpqcrypt.Encrypt(blocks, mpqcrypt.HashString("(block table)", mpqcrypt.HashTable))
+
+	binary.Write(&out, binary.LittleEndian, header)
+	out.Write(make([]byte, 12)) // 64-bit block table offsets of format 2
+	binary.Write(&out, binary.LittleEndian, uint64(header.ArchiveSize))
+	out.Write(make([]byte, int(header.HeaderSize)-(out.Len()-offset)))
+	out.Write(data.Bytes())
+	binary.Write(&out, binary.LittleEndian, hashes)
+	binary.Write(&out, binary.LittleEndian, blocks)
+
+	_, err := out.WriteTo(w)
+
+	return err
+}
+
+// compress returns data zlib compressed, or as-is if that does not help
+func compress(data []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(compressionZlib)
+
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+
+	if buf.Len() >= len(data) {
+		return data
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,47 @@
+package ledger
+
+import "time"
+
+// Status represents how far along the upload of a replay has progressed
+type Status string
+
+// All of the states a replay can be in, from first being seen on disk until
+// sc2replaystats has finished processing it
+const (
+	StatusPending    Status = "pending"
+	StatusUploading  Status = "uploading"
+	StatusProcessing Status = "processing"
+	StatusSuccess    Status = "success"
+	StatusDuplicate  Status = "duplicate"
+	StatusFailed     Status = "failed"
+)
+
+// Entry is the record kept of a single replay, identified by the hash of its
+// contents so that renamed or copied replays are still recognized
+type Entry struct {
+	Hash     string    `json:"hash"`
+	Filename string    `json:"filename"`
+	QueueID  string    `json:"queue_id,omitempty"`
+	ReplayID string    `json:"replay_id,omitempty"`
+	Status   Status    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Created  time.Time `json:"created"`
+	Updated  time.Time `json:"updated"`
+
+	// Modified is when the replay file was last modified, as last seen
+	Modified time.Time `json:"modified"`
+}
+
+// Done returns whether sc2replaystats already has this replay, in which case
+// it should never be uploaded again
+func (e *Entry) Done() bool {
+	return e.Status == StatusSuccess || e.Status == StatusDuplicate
+}
+
+// Unfinished returns whether the upload of this replay was interrupted, for
+// example by the program exiting before sc2replaystats finished processing
+func (e *Entry) Unfinished() bool {
+	return e.Status == StatusPending ||
+		e.Status == StatusUploading ||
+		e.Status == StatusProcessing
+}
@@ -0,0 +1,126 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketReplays = []byte("replays")
+
+// ErrLocked means the ledger is open in another program, such as another
+// instance of sc2-rsu, which keeps it locked until closed
+var ErrLocked = errors.New("ledger is in use by another program")
+
+// Ledger is a durable, file-backed record of every replay we have tried to
+// upload, so that nothing is uploaded twice or lost when the program exits
+type Ledger struct {
+	db *bolt.DB
+}
+
+// Open returns the Ledger stored at path, creating it if it does not exist
+func Open(path string) (*Ledger, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%w: %v", ErrLocked, path)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger: %v: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketReplays)
+		return err
+	})
+
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize ledger: %v", err)
+	}
+
+	return &Ledger{db: db}, nil
+}
+
+// Close releases the underlying file, after which the Ledger cannot be used
+func (l *Ledger) Close() error {
+	return l.db.Close()
+}
+
+// Get returns the Entry recorded for the replay with the given content hash,
+// or nil if the replay has never been seen before
+func (l *Ledger) Get(hash string) (entry *Entry, err error) {
+	err = l.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(bucketReplays).Get([]byte(hash))
+		if data == nil {
+			return nil
+		}
+
+		entry = new(Entry)
+
+		return jsoniter.Unmarshal(data, entry)
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("ledger get: %v", err)
+	}
+
+	return
+}
+
+// Put records the given Entry, replacing any previous Entry for the replay
+func (l *Ledger) Put(entry *Entry) error {
+	if entry.Hash == "" {
+		return fmt.Errorf("ledger put: entry has no hash: %v", entry.Filename)
+	}
+
+	entry.Updated = time.Now()
+	if entry.Created.IsZero() {
+		entry.Created = entry.Updated
+	}
+
+	data, err := jsoniter.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("ledger put: %v", err)
+	}
+
+	if err = l.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReplays).Put([]byte(entry.Hash), data)
+	}); err != nil {
+		return fmt.Errorf("ledger put: %v", err)
+	}
+
+	return nil
+}
+
+// List returns every Entry in the Ledger, in the order they were created
+func (l *Ledger) List() (entries []*Entry, err error) {
+	entries = make([]*Entry, 0)
+
+	err = l.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReplays).ForEach(func(_, data []byte) error {
+			entry := new(Entry)
+			if err := jsoniter.Unmarshal(data, entry); err != nil {
+				return err
+			}
+
+			entries = append(entries, entry)
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("ledger list: %v", err)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+
+	return entries, nil
+}
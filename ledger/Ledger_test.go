@@ -0,0 +1,79 @@
+package ledger_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+)
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.db")
+
+	l, err := ledger.Open(path)
+	assert.Nil(t, err, "must not error")
+
+	entry, err := l.Get("missing")
+	assert.Nil(t, err, "must not error")
+	assert.Nil(t, entry, "unknown replays must not have an entry")
+
+	assert.NotNil(t, l.Put(&ledger.Entry{Filename: "no-hash"}), "entries without a hash must error")
+
+	var cases = []struct {
+		Entry      ledger.Entry
+		Done       bool
+		Unfinished bool
+	}{
+		{ledger.Entry{Hash: "a", Status: ledger.StatusUploading}, false, true},
+		{ledger.Entry{Hash: "b", Status: ledger.StatusProcessing, QueueID: "1"}, false, true},
+		{ledger.Entry{Hash: "c", Status: ledger.StatusSuccess, QueueID: "2", ReplayID: "3"}, true, false},
+		{ledger.Entry{Hash: "d", Status: ledger.StatusDuplicate, ReplayID: "4"}, true, false},
+		{ledger.Entry{Hash: "e", Status: ledger.StatusFailed}, false, false},
+	}
+
+	for _, c := range cases {
+		e := c.Entry
+		assert.Nil(t, l.Put(&e), "must not error")
+		assert.False(t, e.Created.IsZero(), "created must be set")
+	}
+
+	// entries must survive re-opening the ledger
+	assert.Nil(t, l.Close(), "must not error")
+	l, err = ledger.Open(path)
+	assert.Nil(t, err, "must not error")
+	defer l.Close()
+
+	_, err = ledger.Open(path)
+	assert.True(t, errors.Is(err, ledger.ErrLocked), "ledgers open elsewhere must be locked: %v", err)
+
+	entries, err := l.List()
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, len(cases), len(entries), "all entries must be listed")
+
+	for i, c := range cases {
+		e, err := l.Get(c.Entry.Hash)
+		assert.Nil(t, err, "must not error")
+		assert.Equal(t, c.Entry.Hash, entries[i].Hash, "entries must be listed in order")
+		assert.Equal(t, c.Entry.Status, e.Status, "status must match")
+		assert.Equal(t, c.Entry.QueueID, e.QueueID, "queue ID must match")
+		assert.Equal(t, c.Entry.ReplayID, e.ReplayID, "replay ID must match")
+		assert.Equal(t, c.Done, e.Done(), "done must match")
+		assert.Equal(t, c.Unfinished, e.Unfinished(), "unfinished must match")
+	}
+}
+
+func TestHashFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(path, []byte("hello"), 0644), "must not error")
+
+	hash, err := ledger.HashFile(path)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", hash, "hash must match")
+
+	_, err = ledger.HashFile(path + ".missing")
+	assert.NotNil(t, err, "must error")
+}
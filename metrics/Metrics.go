@@ -0,0 +1,307 @@
+// Package metrics keeps counters, gauges and histograms, and serves them in
+// the Prometheus text exposition format (version 0.0.4) to be scraped.
+//
+// It covers only what the uploader needs, rather than depending on the
+// Prometheus client library (and protobuf, procfs, ... with it) for the
+// handful of metrics an optional feature of a desktop program exposes.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is anything a Registry can expose
+type metric interface {
+	write(w io.Writer)
+}
+
+// Registry is the http.Handler exposing every metric created with it, in the
+// order they were created
+type Registry struct {
+	metrics []metric
+	mu      sync.Mutex
+}
+
+// NewRegistry returns an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: make([]metric, 0)}
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.metrics = append(r.metrics, m)
+}
+
+// ServeHTTP writes every metric in the Prometheus text format
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	metrics := r.metrics
+	r.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Counter is a value which only ever goes up, such as replays uploaded
+type Counter struct {
+	desc
+	mu sync.Mutex
+	v  float64
+}
+
+// Counter returns a new Counter, starting at zero
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{desc: desc{name, help, "counter"}}
+	r.add(c)
+
+	return c
+}
+
+// Inc adds one to the Counter
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative, to the Counter
+func (c *Counter) Add(v float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.v += v
+}
+
+// Value returns the current value of the Counter
+func (c *Counter) Value() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.v
+}
+
+func (c *Counter) write(w io.Writer) {
+	c.header(w)
+	c.sample(w, "", nil, c.Value())
+}
+
+// CounterVec is a Counter for each value of a label, such as failures by
+// reason
+type CounterVec struct {
+	desc
+	label  string
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// CounterVec returns a new CounterVec, with no values of label yet
+func (r *Registry) CounterVec(name, help, label string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter"}, label: label, values: make(map[string]float64)}
+	r.add(c)
+
+	return c
+}
+
+// Inc adds one to the Counter of a label value
+func (c *CounterVec) Inc(value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[value]++
+}
+
+// Value returns the current value of the Counter of a label value
+func (c *CounterVec) Value(value string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.values[value]
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	values := make([]string, 0, len(c.values))
+	for v := range c.values {
+		values = append(values, v)
+	}
+
+	sort.Strings(values)
+
+	c.header(w)
+	for _, v := range values {
+		c.sample(w, "", []string{c.label, v}, c.values[v])
+	}
+}
+
+// Gauge is a value which goes up and down, such as uploads in-flight
+type Gauge struct {
+	desc
+	fn func() float64
+	mu sync.Mutex
+	v  float64
+}
+
+// Gauge returns a new Gauge, starting at zero
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{desc: desc{name, help, "gauge"}}
+	r.add(g)
+
+	return g
+}
+
+// GaugeFunc returns a new Gauge whose value is what fn returns each time it
+// is scraped; Set and Add have no effect on it
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) *Gauge {
+	g := &Gauge{desc: desc{name, help, "gauge"}, fn: fn}
+	r.add(g)
+
+	return g
+}
+
+// Set changes the value of the Gauge
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.v = v
+}
+
+// Add adds v, which may be negative, to the Gauge
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.v += v
+}
+
+// Value returns the current value of the Gauge
+func (g *Gauge) Value() float64 {
+	if g.fn != nil {
+		return g.fn()
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.v
+}
+
+func (g *Gauge) write(w io.Writer) {
+	g.header(w)
+	g.sample(w, "", nil, g.Value())
+}
+
+// Histogram counts observations, such as how long uploads took, into buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	mu      sync.Mutex
+	sum     float64
+}
+
+// Histogram returns a new Histogram, counting observations less than or equal
+// to each of the upper bounds given, which must be in increasing order
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, "histogram"},
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+	r.add(h)
+
+	return h
+}
+
+// Observe counts an observation
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+
+	h.count++
+	h.sum += v
+}
+
+// Count returns how many observations were counted
+func (h *Histogram) Count() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.header(w)
+	for i, b := range h.buckets {
+		h.sample(w, "_bucket", []string{"le", formatFloat(b)}, float64(h.counts[i]))
+	}
+
+	h.sample(w, "_bucket", []string{"le", "+Inf"}, float64(h.count))
+	h.sample(w, "_sum", nil, h.sum)
+	h.sample(w, "_count", nil, float64(h.count))
+}
+
+// desc describes a metric, and writes it out
+type desc struct {
+	name string
+	help string
+	kind string
+}
+
+func (d desc) header(w io.Writer) {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(d.help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, help, d.name, d.kind)
+}
+
+// sample writes a value, with labels given as name and value pairs
+func (d desc) sample(w io.Writer, suffix string, labels []string, v float64) {
+	var l string
+
+	if len(labels) > 0 {
+		escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escape.Replace(labels[i+1])))
+		}
+
+		l = "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	fmt.Fprintf(w, "%s%s%s %s\n", d.name, suffix, l, formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,124 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/metrics"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+func scrape(r *metrics.Registry) string {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	return w.Body.String()
+}
+
+func TestRegistry(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	c := r.Counter("test_total", "A counter.")
+	c.Inc()
+	c.Add(2)
+
+	v := r.CounterVec("test_reasons_total", "Counters by reason.", "reason")
+	v.Inc("b")
+	v.Inc("a \"quoted\"")
+	v.Inc("b")
+
+	g := r.Gauge("test_gauge", "A gauge,\nover two lines.")
+	g.Set(5)
+	g.Add(-1.5)
+
+	r.GaugeFunc("test_func", "A gauge func.", func() float64 { return 7 })
+
+	h := r.Histogram("test_seconds", "A histogram.", []float64{1, 5})
+	h.Observe(0.5)
+	h.Observe(3)
+	h.Observe(10)
+
+	expected := `# HELP test_total A counter.
+# TYPE test_total counter
+test_total 3
+# HELP test_reasons_total Counters by reason.
+# TYPE test_reasons_total counter
+test_reasons_total{reason="a \"quoted\""} 1
+test_reasons_total{reason="b"} 2
+# HELP test_gauge A gauge,\nover two lines.
+# TYPE test_gauge gauge
+test_gauge 3.5
+# HELP test_func A gauge func.
+# TYPE test_func gauge
+test_func 7
+# HELP test_seconds A histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 1
+test_seconds_bucket{le="5"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 13.5
+test_seconds_count 3
+`
+
+	assert.Equal(t, expected, scrape(r), "must be in the Prometheus text format")
+}
+
+func TestUploads(t *testing.T) {
+	r := metrics.NewRegistry()
+	u := metrics.NewUploads(r, func() int { return 2 })
+
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	u.OnEvent(uploader.Event{Type: uploader.EventQueued, Filename: "a", Time: at(0)})
+	u.OnEvent(uploader.Event{Type: uploader.EventQueued, Filename: "b", Time: at(0)})
+	assert.Equal(t, float64(2), u.Queued.Value(), "queued replays must be counted")
+
+	u.OnEvent(uploader.Event{Type: uploader.EventUploading, Filename: "a", Time: at(time.Second)})
+	u.OnEvent(uploader.Event{Type: uploader.EventProcessing, Filename: "a", Time: at(3 * time.Second)})
+	u.OnEvent(uploader.Event{Type: uploader.EventProgress, Filename: "a", Polls: 1, Time: at(4 * time.Second)})
+	u.OnEvent(uploader.Event{Type: uploader.EventSuccess, Filename: "a", Time: at(13 * time.Second)})
+	u.OnEvent(uploader.Event{Type: uploader.EventFailed, Filename: "b", Err: context.Canceled, Time: at(time.Second)})
+
+	assert.Equal(t, float64(2), u.Seen.Value(), "replays seen must be counted")
+	assert.Equal(t, float64(1), u.Uploaded.Value(), "replays uploaded must be counted")
+	assert.Equal(t, float64(1), u.Failures.Value("cancelled"), "failures must be counted by reason")
+	assert.Equal(t, float64(0), u.Queued.Value(), "done replays must leave the queue")
+	assert.Equal(t, uint64(1), u.UploadSeconds.Count(), "upload latency must be observed")
+	assert.Equal(t, uint64(1), u.ProcessingSeconds.Count(), "processing time must be observed")
+
+	out := scrape(r)
+	assert.Contains(t, out, "sc2rsu_upload_duration_seconds_sum 2\n", "upload latency must be exposed")
+	assert.Contains(t, out, "sc2rsu_processing_duration_seconds_sum 10\n", "processing time must be exposed")
+	assert.Contains(t, out, "sc2rsu_watched_directories 2\n", "watched directories must be exposed")
+}
+
+func TestFailureReason(t *testing.T) {
+	var cases = []struct {
+		Err    error
+		Reason string
+	}{
+		{context.Canceled, "cancelled"},
+		{fmt.Errorf("upload: %w", context.DeadlineExceeded), "timeout"},
+		{&sc2replaystats.APIError{Status: 401, Err: sc2replaystats.ErrUnauthorized}, "unauthorized"},
+		{&sc2replaystats.APIError{Status: 429, Err: &sc2replaystats.ErrRateLimited{}}, "rate_limited"},
+		{&sc2replaystats.ErrProcessing{Reason: "corrupt"}, "processing"},
+		{&sc2replaystats.APIError{Status: 502}, "server"},
+		{&sc2replaystats.APIError{Status: 400}, "rejected"},
+		{errors.New("no API key"), "other"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Reason, metrics.FailureReason(c.Err), c.Err.Error())
+	}
+
+	assert.Equal(t, "other", metrics.FailureReason(nil), "must not crash without error")
+}
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+var (
+	// UploadBuckets are the upper bounds, in seconds, of the upload latency
+	// histogram
+	UploadBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+	// ProcessingBuckets are the upper bounds, in seconds, of the server
+	// processing time histogram
+	ProcessingBuckets = []float64{1, 2, 5, 10, 20, 30, 60, 120, 300, 600}
+)
+
+// Uploads counts what an uploader does, by being subscribed to it (see
+// OnEvent)
+type Uploads struct {
+	Seen       *Counter
+	Uploaded   *Counter
+	Duplicates *Counter
+	Failures   *CounterVec
+
+	// UploadSeconds is how long sending replays took, until sc2replaystats
+	// accepted them into its queue
+	UploadSeconds *Histogram
+
+	// ProcessingSeconds is how long sc2replaystats took processing replays
+	// once accepted, as found by polling their status
+	ProcessingSeconds *Histogram
+
+	// Queued counts the replays seen which are not done yet
+	Queued *Gauge
+
+	mu         sync.Mutex
+	processing map[string]time.Time
+	queued     map[string]struct{}
+	uploading  map[string]time.Time
+}
+
+// NewUploads returns the upload metrics, registered with r, along with the
+// number of directories watched as told by watched
+func NewUploads(r *Registry, watched func() int) *Uploads {
+	u := &Uploads{
+		Seen:              r.Counter("sc2rsu_replays_seen_total", "Replays found to be uploaded."),
+		Uploaded:          r.Counter("sc2rsu_replays_uploaded_total", "Replays uploaded and processed by sc2replaystats."),
+		Duplicates:        r.Counter("sc2rsu_replays_duplicate_total", "Replays sc2replaystats already had."),
+		Failures:          r.CounterVec("sc2rsu_upload_failures_total", "Replays which failed to upload, by reason.", "reason"),
+		UploadSeconds:     r.Histogram("sc2rsu_upload_duration_seconds", "Time taken sending replays to sc2replaystats.", UploadBuckets),
+		ProcessingSeconds: r.Histogram("sc2rsu_processing_duration_seconds", "Time sc2replaystats took processing replays.", ProcessingBuckets),
+		Queued:            r.Gauge("sc2rsu_upload_queue_depth", "Replays found which are not done uploading yet."),
+		processing:        make(map[string]time.Time),
+		queued:            make(map[string]struct{}),
+		uploading:         make(map[string]time.Time),
+	}
+
+	r.GaugeFunc("sc2rsu_watched_directories", "Replay directories watched for new replays.", func() float64 {
+		return float64(watched())
+	})
+
+	return u
+}
+
+// OnEvent counts an event of the uploader, to be passed to
+// uploader.Subscribe
+func (u *Uploads) OnEvent(ev uploader.Event) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	switch ev.Type {
+	case uploader.EventQueued:
+		u.Seen.Inc()
+		u.queued[ev.Filename] = struct{}{}
+	case uploader.EventUploading:
+		u.uploading[ev.Filename] = ev.Time
+	case uploader.EventProcessing:
+		if start, ok := u.uploading[ev.Filename]; ok {
+			u.UploadSeconds.Observe(ev.Time.Sub(start).Seconds())
+		}
+
+		u.processing[ev.Filename] = ev.Time
+	case uploader.EventSuccess:
+		u.Uploaded.Inc()
+	case uploader.EventDuplicate:
+		u.Duplicates.Inc()
+	case uploader.EventFailed:
+		u.Failures.Inc(FailureReason(ev.Err))
+	}
+
+	if !ev.Type.Done() {
+		u.Queued.Set(float64(len(u.queued)))
+		return
+	}
+
+	// the time taken by replays cancelled says nothing of sc2replaystats
+	if start, ok := u.processing[ev.Filename]; ok && !errors.Is(ev.Err, context.Canceled) {
+		u.ProcessingSeconds.Observe(ev.Time.Sub(start).Seconds())
+	}
+
+	delete(u.processing, ev.Filename)
+	delete(u.queued, ev.Filename)
+	delete(u.uploading, ev.Filename)
+	u.Queued.Set(float64(len(u.queued)))
+}
+
+// FailureReason returns a short reason for an upload failing, one of
+// "cancelled", "timeout", "unauthorized", "rate_limited", "processing",
+// "server", "rejected", "network" or "other"
+func FailureReason(err error) string {
+	var (
+		apiErr  *sc2replaystats.APIError
+		limited *sc2replaystats.ErrRateLimited
+		netErr  net.Error
+		procErr *sc2replaystats.ErrProcessing
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "cancelled"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, uploader.ErrStillProcessing):
+		return "timeout"
+	case errors.Is(err, sc2replaystats.ErrUnauthorized):
+		return "unauthorized"
+	case errors.As(err, &limited):
+		return "rate_limited"
+	case errors.As(err, &procErr):
+		return "processing"
+	case errors.As(err, &apiErr) && apiErr.Status >= 500:
+		return "server"
+	case errors.As(err, &apiErr):
+		return "rejected"
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return "timeout"
+		}
+
+		return "network"
+	}
+
+	return "other"
+}
@@ -0,0 +1,459 @@
+package mpq
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqcrypt"
+)
+
+// file flags found in the block table
+const (
+	flagImplode    = 0x00000100
+	flagCompress   = 0x00000200
+	flagEncrypted  = 0x00010000
+	flagSingleUnit = 0x01000000
+	flagSectorCRC  = 0x04000000
+	flagExists     = 0x80000000
+)
+
+// compression types found in the first byte of compressed data
+const (
+	compressionZlib  = 0x02
+	compressionBzip2 = 0x10
+)
+
+var (
+	// ErrNotArchive means the data does not start with an MPQ header
+	ErrNotArchive = errors.New("not an MPQ archive")
+
+	// ErrNotFound means the archive does not contain the requested file
+	ErrNotFound = errors.New("file not found in MPQ archive")
+
+	// ErrTruncated means the archive is shorter than its header claims,
+	// which is the case while it is still being written
+	ErrTruncated = errors.New("MPQ archive is truncated")
+
+	// ErrUnsupported means the file uses a feature this package lacks
+	ErrUnsupported = errors.New("unsupported MPQ feature")
+)
+
+var (
+	magicHeader   = [4]byte{'M', 'P', 'Q', 0x1A}
+	magicUserData = [4]byte{'M', 'P', 'Q', 0x1B}
+)
+
+// Header is the MPQ archive header, see http://www.zezula.net/en/mpq/mpqformat.html
+type Header struct {
+	Magic             [4]byte
+	HeaderSize        uint32
+	ArchiveSize       uint32
+	FormatVersion     uint16
+	SectorSizeShift   uint16
+	HashTableOffset   uint32
+	BlockTableOffset  uint32
+	HashTableEntries  uint32
+	BlockTableEntries uint32
+}
+
+// headerV3 is the part of the MPQ header added by format 3 (FormatVersion 2),
+// following the 32 bytes of Header and the 12 added by format 2; StarCraft II
+// replays use format 4, which adds more after it
+type headerV3 struct {
+	ArchiveSize64 uint64
+}
+
+// offsetV3 is where headerV3 begins within the MPQ header
+const offsetV3 = 0x2C
+
+type hashEntry struct {
+	HashA      uint32
+	HashB      uint32
+	Locale     uint16
+	Platform   uint16
+	BlockIndex uint32
+}
+
+type blockEntry struct {
+	Offset       uint32
+	ArchivedSize uint32
+	Size         uint32
+	Flags        uint32
+}
+
+// Archive is an opened MPQ archive, such as a StarCraft II replay
+type Archive struct {
+	// Header is the archive's MPQ header
+	Header Header
+
+	// Offset is where the MPQ header is found, after the user data (if any)
+	Offset int64
+
+	// UserData is the content of the user data section preceding the MPQ
+	// header, which StarCraft II uses to store the replay header
+	UserData []byte
+
+	r           io.ReaderAt
+	size        int64
+	archiveSize int64
+	closer      io.Closer
+	hashes      []hashEntry
+	blocks      []blockEntry
+}
+
+// Open opens the named MPQ archive, which must be closed after use
+func Open(name string) (*Archive, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	a, err := NewArchive(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	a.closer = f
+
+	return a, nil
+}
+
+// NewArchive reads the MPQ archive of the given size from r
+func NewArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	a := &Archive{r: r, size: size}
+
+	if err := a.readHeader(); err != nil {
+		return nil, err
+	}
+
+	if err := a.readTables(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// Close closes the underlying file if the Archive was created by Open
+func (a *Archive) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+
+	return a.closer.Close()
+}
+
+// SectorSize returns the size of the sectors files are split into
+func (a *Archive) SectorSize() uint32 {
+	return 512 << a.Header.SectorSizeShift
+}
+
+// Size returns the size of the whole archive, including any user data, as
+// stated by its header; an archive still being written may be smaller
+func (a *Archive) Size() int64 {
+	return a.Offset + a.archiveSize
+}
+
+// Complete returns ErrTruncated unless the whole archive was written: it is
+// as large as its header states, and every file of its block table is within
+// it, which a replay StarCraft II is still writing is not
+func (a *Archive) Complete() error {
+	if a.size < a.Size() {
+		return fmt.Errorf("%w: %d of %d bytes", ErrTruncated, a.size, a.Size())
+	}
+
+	for i, b := range a.blocks {
+		if b.Flags&flagExists != 0 && a.Offset+int64(b.Offset)+int64(b.ArchivedSize) > a.size {
+			return fmt.Errorf("%w: block %d ends past the archive", ErrTruncated, i)
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) readHeader() error {
+	var magic [4]byte
+	if err := a.readAt(magic[:], 0); err != nil {
+		return err
+	}
+
+	if magic != magicUserData && magic != magicHeader {
+		return ErrNotArchive
+	}
+
+	if magic == magicUserData {
+		var ud struct {
+			Magic          [4]byte
+			UserDataSize   uint32
+			HeaderOffset   uint32
+			UserHeaderSize uint32
+		}
+
+		if err := a.readStruct(&ud, 0); err != nil {
+			return err
+		}
+
+		if 16+int64(ud.UserHeaderSize) > a.size {
+			return ErrTruncated
+		}
+
+		a.UserData = make([]byte, ud.UserHeaderSize)
+		if err := a.readAt(a.UserData, 16); err != nil {
+			return err
+		}
+
+		a.Offset = int64(ud.HeaderOffset)
+	}
+
+	if err := a.readStruct(&a.Header, a.Offset); err != nil {
+		return err
+	}
+
+	if a.Header.Magic != magicHeader {
+		return ErrNotArchive
+	}
+
+	// the 32-bit size is deprecated from format 2, its 64-bit replacement is
+	// to be used instead where the header is large enough to hold it
+	a.archiveSize = int64(a.Header.ArchiveSize)
+
+	if a.Header.FormatVersion >= 2 && a.Header.HeaderSize >= offsetV3+8 {
+		var v3 headerV3
+		if err := a.readStruct(&v3, a.Offset+offsetV3); err != nil {
+			return err
+		}
+
+		if int64(v3.ArchiveSize64) > 0 {
+			a.archiveSize = int64(v3.ArchiveSize64)
+		}
+	}
+
+	return nil
+}
+
+func (a *Archive) readTables() error {
+	// don't trust the header enough to allocate more than the archive holds
+	if 16*(int64(a.Header.HashTableEntries)+int64(a.Header.BlockTableEntries)) > a.size {
+		return ErrTruncated
+	}
+
+	hashes := make([]uint32, 4*a.Header.HashTableEntries)
+	if err := a.readTable(hashes, a.Header.HashTableOffset, "(hash table)"); err != nil {
+		return fmt.Errorf("hash table: %w", err)
+	}
+
+	blocks := make([]uint32, 4*a.Header.BlockTableEntries)
+	if err := a.readTable(blocks, a.Header.BlockTableOffset, "(block table)"); err != nil {
+		return fmt.Errorf("block table: %w", err)
+	}
+
+	a.hashes = make([]hashEntry, a.Header.HashTableEntries)
+	for i := range a.hashes {
+		v := hashes[4*i:]
+		a.hashes[i] = hashEntry{v[0], v[1], uint16(v[2]), uint16(v[2] >> 16), v[3]}
+	}
+
+	a.blocks = make([]blockEntry, a.Header.BlockTableEntries)
+	for i := range a.blocks {
+		v := blocks[4*i:]
+		a.blocks[i] = blockEntry{v[0], v[1], v[2], v[3]}
+	}
+
+	return nil
+}
+
+func (a *Archive) readTable(table []uint32, offset uint32, key string) error {
+	if err := a.readStruct(table, a.Offset+int64(offset)); err != nil {
+		return err
+	}
+
+	mpqcrypt.Decrypt(table, mpqcrypt.HashString(key, mpqcrypt.HashTable))
+
+	return nil
+}
+
+// Has returns whether the archive contains the named file
+func (a *Archive) Has(name string) bool {
+	_, err := a.block(name)
+	return err == nil
+}
+
+// ReadFile returns the decompressed contents of the named file
+func (a *Archive) ReadFile(name string) ([]byte, error) {
+	block, err := a.block(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if block.Flags&(flagEncrypted|flagImplode) != 0 {
+		return nil, fmt.Errorf("%s: %w: flags %#x", name, ErrUnsupported, block.Flags)
+	}
+
+	if a.Offset+int64(block.Offset)+int64(block.ArchivedSize) > a.size {
+		return nil, fmt.Errorf("%s: %w", name, ErrTruncated)
+	}
+
+	data := make([]byte, block.ArchivedSize)
+	if err = a.readAt(data, a.Offset+int64(block.Offset)); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if block.Flags&flagSingleUnit != 0 {
+		if block.Flags&flagCompress != 0 && block.Size > block.ArchivedSize {
+			if data, err = decompress(data, block.Size); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+
+		return data, nil
+	}
+
+	if data, err = a.readSectors(data, block); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return data, nil
+}
+
+func (a *Archive) readSectors(data []byte, block blockEntry) ([]byte, error) {
+	sectorSize := a.SectorSize()
+	sectors := (block.Size + sectorSize - 1) / sectorSize
+	if block.Flags&flagSectorCRC != 0 {
+		sectors++
+	}
+
+	if len(data) < 4*int(sectors+1) {
+		return nil, ErrTruncated
+	}
+
+	positions := make([]uint32, sectors+1)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, positions)
+
+	if block.Flags&flagSectorCRC != 0 {
+		positions = positions[:len(positions)-1]
+	}
+
+	result := make([]byte, 0, len(data))
+	left := block.Size
+
+	for i := 0; i+1 < len(positions); i++ {
+		start, end := positions[i], positions[i+1]
+		if start > end || end > uint32(len(data)) {
+			return nil, fmt.Errorf("bad sector offsets: %w", ErrTruncated)
+		}
+
+		sector := data[start:end]
+		expect := sectorSize
+		if left < expect {
+			expect = left
+		}
+
+		if block.Flags&flagCompress != 0 && uint32(len(sector)) < expect {
+			var err error
+			if sector, err = decompress(sector, expect); err != nil {
+				return nil, err
+			}
+		}
+
+		result = append(result, sector...)
+		left -= uint32(len(sector))
+	}
+
+	return result, nil
+}
+
+func (a *Archive) block(name string) (blockEntry, error) {
+	n := uint32(len(a.hashes))
+	if n == 0 {
+		return blockEntry{}, ErrNotFound
+	}
+
+	start := mpqcrypt.HashString(name, mpqcrypt.HashTableOffset) % n
+	ha, hb := mpqcrypt.HashString(name, mpqcrypt.HashA), mpqcrypt.HashString(name, mpqcrypt.HashB)
+
+	for i := uint32(0); i < n; i++ {
+		e := a.hashes[(start+i)%n]
+
+		if e.BlockIndex == 0xFFFFFFFF {
+			break // empty, never used
+		}
+
+		if e.HashA != ha || e.HashB != hb || e.BlockIndex >= uint32(len(a.blocks)) {
+			continue // deleted (0xFFFFFFFE) or another file
+		}
+
+		if b := a.blocks[e.BlockIndex]; b.Flags&flagExists != 0 {
+			return b, nil
+		}
+	}
+
+	return blockEntry{}, ErrNotFound
+}
+
+func (a *Archive) readAt(p []byte, off int64) error {
+	if off+int64(len(p)) > a.size {
+		return ErrTruncated
+	}
+
+	if _, err := a.r.ReadAt(p, off); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrTruncated
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (a *Archive) readStruct(data interface{}, off int64) error {
+	p := make([]byte, binary.Size(data))
+	if err := a.readAt(p, off); err != nil {
+		return err
+	}
+
+	return binary.Read(bytes.NewReader(p), binary.LittleEndian, data)
+}
+
+func decompress(data []byte, size uint32) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+
+	var r io.Reader
+
+	switch data[0] {
+	case compressionZlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data[1:]))
+		if err != nil {
+			return nil, fmt.Errorf("zlib: %v", err)
+		}
+		defer zr.Close()
+
+		r = zr
+	case compressionBzip2:
+		r = bzip2.NewReader(bytes.NewReader(data[1:]))
+	default:
+		return nil, fmt.Errorf("%w: compression %#x", ErrUnsupported, data[0])
+	}
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(size)))
+	if err != nil {
+		return nil, fmt.Errorf("decompress: %v", err)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,131 @@
+package mpq_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqtest"
+	"github.com/AlbinoGeek/sc2-rsu/mpq"
+)
+
+func TestArchive(t *testing.T) {
+	var cases = []struct {
+		Name       string
+		Data       []byte
+		SingleUnit bool
+	}{
+		{"replay.details", []byte("details"), false},
+		{"replay.initData", bytes.Repeat([]byte("initData"), 2048), false},
+		{"replay.attributes.events", []byte(strings.Repeat("attr", 100)), true},
+		{"(listfile)", []byte{}, false},
+	}
+
+	files := make([]mpqtest.File, len(cases))
+	for i, c := range cases {
+		files[i] = mpqtest.File{Name: c.Name, Data: c.Data, SingleUnit: c.SingleUnit}
+	}
+
+	var buf bytes.Buffer
+	assert.Nil(t, mpqtest.Write(&buf, []byte("user data"), files), "must not error")
+
+	a, err := mpq.NewArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, []byte("user data"), a.UserData, "user data must match")
+	assert.Equal(t, int64(buf.Len()), a.Size(), "archive size must match")
+
+	for _, c := range cases {
+		data, err := a.ReadFile(c.Name)
+		assert.Nil(t, err, "must not error: %v", c.Name)
+		assert.Equal(t, c.Data, data, "contents must match: %v", c.Name)
+		assert.True(t, a.Has(strings.ToUpper(c.Name)), "names must be case insensitive: %v", c.Name)
+	}
+
+	_, err = a.ReadFile("replay.game.events")
+	assert.True(t, errors.Is(err, mpq.ErrNotFound), "missing files must not be found")
+}
+
+func TestArchiveErrors(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, mpqtest.Write(&buf, nil, []mpqtest.File{{Name: "a", Data: []byte("a")}}), "must not error")
+	archive := buf.Bytes()
+
+	// user data whose header claims to be larger than the whole archive
+	huge := append([]byte(nil), archive...)
+	copy(huge, "MPQ\x1b")
+	binary.LittleEndian.PutUint32(huge[12:], 0xFFFFFFFF)
+
+	var cases = []struct {
+		Data []byte
+		Err  error
+	}{
+		{[]byte{}, mpq.ErrTruncated},
+		{[]byte("not an archive at all, not even a little bit"), mpq.ErrNotArchive},
+		{archive[:40], mpq.ErrTruncated},
+		{archive[:len(archive)-1], mpq.ErrTruncated},
+		{huge, mpq.ErrTruncated},
+	}
+
+	for _, c := range cases {
+		_, err := mpq.NewArchive(bytes.NewReader(c.Data), int64(len(c.Data)))
+		assert.True(t, errors.Is(err, c.Err), "error must match: %v", err)
+	}
+}
+
+func TestArchiveComplete(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Nil(t, mpqtest.Write(&buf, []byte("user data"), []mpqtest.File{{Name: "a", Data: []byte("a")}}), "must not error")
+
+	a, err := mpq.NewArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Nil(t, err, "must not error")
+	assert.Nil(t, a.Complete(), "written archives must be complete")
+
+	// the deprecated 32-bit size must not be used where the 64-bit one is
+	data := append([]byte{}, buf.Bytes()...)
+	binary.LittleEndian.PutUint32(data[a.Offset+8:], 0)
+
+	a, err = mpq.NewArchive(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err, "must not error")
+	assert.Nil(t, a.Complete(), "archives must be complete by their 64-bit size")
+
+	// an archive whose tables were written, but not all of its data yet
+	binary.LittleEndian.PutUint64(data[a.Offset+0x2C:], uint64(len(data)+1024))
+
+	a, err = mpq.NewArchive(bytes.NewReader(data), int64(len(data)))
+	assert.Nil(t, err, "must not error")
+	assert.True(t, errors.Is(a.Complete(), mpq.ErrTruncated), "archives smaller than their header states must not be complete")
+}
+
+// TestArchiveCompleteReplays checks every sample replay, whole and cut short
+// anywhere, as StarCraft II leaves them while still writing
+func TestArchiveCompleteReplays(t *testing.T) {
+	replays, err := filepath.Glob(filepath.Join("..", "sc2replay", "testdata", "*.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+	assert.NotEmpty(t, replays, "must have sample replays")
+
+	for _, name := range replays {
+		data, err := ioutil.ReadFile(name)
+		assert.Nil(t, err, "must not error")
+
+		a, err := mpq.NewArchive(bytes.NewReader(data), int64(len(data)))
+		if assert.Nil(t, err, "must not error: %v", name) {
+			assert.Nil(t, a.Complete(), "whole replays must be complete: %v", name)
+			assert.Equal(t, int64(len(data)), a.Size(), "size must match: %v", name)
+		}
+
+		for size := 0; size < len(data); size += 1 + size/8 {
+			a, err := mpq.NewArchive(bytes.NewReader(data[:size]), int64(size))
+			if err == nil {
+				err = a.Complete()
+			}
+
+			assert.True(t, errors.Is(err, mpq.ErrTruncated), "replays cut at %d bytes must be truncated: %v: %v", size, name, err)
+		}
+	}
+}
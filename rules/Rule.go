@@ -0,0 +1,190 @@
+package rules
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replay"
+)
+
+// Action is what happens to a replay matching a Rule
+type Action string
+
+// Actions a Rule can take
+const (
+	ActionInclude Action = "include"
+	ActionExclude Action = "exclude"
+)
+
+// Rule matches replays by their metadata; every condition given must match,
+// and conditions taking a list match when any one of their values does
+type Rule struct {
+	// Name is shown when explaining why a replay was (not) uploaded
+	Name string `mapstructure:"name"`
+
+	// Action is either "include" or "exclude"
+	Action Action `mapstructure:"action"`
+
+	// Mode matches the game mode: "ladder", "custom", "vs-ai" or "unknown"
+	Mode []string `mapstructure:"mode"`
+
+	// ShorterThan matches games lasting less than the duration, such as "1m"
+	ShorterThan time.Duration `mapstructure:"shorter_than"`
+
+	// LongerThan matches games lasting more than the duration
+	LongerThan time.Duration `mapstructure:"longer_than"`
+
+	// Opponent matches the name or toon handle of any opponent (glob)
+	Opponent []string `mapstructure:"opponent"`
+
+	// Matchup matches the races, own team first, such as "PvZ" or "*vT" (glob)
+	Matchup []string `mapstructure:"matchup"`
+
+	// Map matches the title of the map played, such as "*LE" (glob)
+	Map []string `mapstructure:"map"`
+
+	// Toon matches the toon handle the replay was saved by (glob)
+	Toon []string `mapstructure:"toon"`
+}
+
+// String returns the name of the rule, such as `rule "no-ai"`
+func (r Rule) String() string {
+	if r.Name != "" {
+		return fmt.Sprintf("rule %q", r.Name)
+	}
+
+	return "rule"
+}
+
+// Validate returns an error describing the first problem with the rule
+func (r Rule) Validate() error {
+	if r.Action != ActionInclude && r.Action != ActionExclude {
+		return fmt.Errorf("%v: action must be %q or %q, not %q", r, ActionInclude, ActionExclude, r.Action)
+	}
+
+	for _, m := range r.Mode {
+		switch m {
+		case string(sc2replay.ModeLadder), string(sc2replay.ModeCustom), string(sc2replay.ModeVersusAI), "unknown":
+		default:
+			return fmt.Errorf("%v: unknown mode %q", r, m)
+		}
+	}
+
+	if r.ShorterThan < 0 || r.LongerThan < 0 {
+		return fmt.Errorf("%v: durations must not be negative", r)
+	}
+
+	for _, patterns := range [][]string{r.Opponent, r.Matchup, r.Map, r.Toon} {
+		for _, p := range patterns {
+			if _, err := filepath.Match(p, ""); err != nil {
+				return fmt.Errorf("%v: invalid pattern %q: %v", r, p, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Match returns whether the replay, saved by the given toon, matches every
+// condition of the rule, and if so descriptions of the conditions matched
+func (r Rule) Match(replay *sc2replay.Replay, toon string) (bool, []string) {
+	reasons := make([]string, 0)
+
+	if len(r.Mode) > 0 {
+		mode := string(replay.Mode)
+		if mode == "" {
+			mode = "unknown"
+		}
+
+		if !contains(r.Mode, mode) {
+			return false, nil
+		}
+
+		reasons = append(reasons, "mode is "+mode)
+	}
+
+	if r.ShorterThan > 0 {
+		if replay.Length >= r.ShorterThan {
+			return false, nil
+		}
+
+		reasons = append(reasons, fmt.Sprintf("lasted %v, shorter than %v", replay.Length, r.ShorterThan))
+	}
+
+	if r.LongerThan > 0 {
+		if replay.Length <= r.LongerThan {
+			return false, nil
+		}
+
+		reasons = append(reasons, fmt.Sprintf("lasted %v, longer than %v", replay.Length, r.LongerThan))
+	}
+
+	if len(r.Opponent) > 0 {
+		matched := ""
+
+		for _, o := range replay.Opponents(toon) {
+			if match(r.Opponent, o.Name) || match(r.Opponent, o.Toon.String()) {
+				matched = o.Name
+				break
+			}
+		}
+
+		if matched == "" {
+			return false, nil
+		}
+
+		reasons = append(reasons, "opponent is "+matched)
+	}
+
+	if len(r.Matchup) > 0 {
+		matchup := replay.MatchupOf(toon)
+		if !match(r.Matchup, matchup) {
+			return false, nil
+		}
+
+		reasons = append(reasons, "matchup is "+matchup)
+	}
+
+	if len(r.Map) > 0 {
+		if !match(r.Map, replay.Map) {
+			return false, nil
+		}
+
+		reasons = append(reasons, "map is "+replay.Map)
+	}
+
+	if len(r.Toon) > 0 {
+		if !match(r.Toon, toon) {
+			return false, nil
+		}
+
+		reasons = append(reasons, "toon is "+toon)
+	}
+
+	return true, reasons
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, h := range haystack {
+		if strings.EqualFold(h, needle) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// match returns whether value matches any of the glob patterns, ignoring case
+func match(patterns []string, value string) bool {
+	value = strings.ToLower(value)
+
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(strings.ToLower(p), value); ok {
+			return true
+		}
+	}
+
+	return false
+}
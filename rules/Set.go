@@ -0,0 +1,90 @@
+// Package rules decides which replays are uploaded based on their metadata,
+// using an ordered list of rules where the first rule matching a replay
+// decides whether it is included or excluded.
+//
+// An example configuration, skipping games against the computer and games
+// left within the first minute, but uploading every ladder game:
+//
+//	filters:
+//	  - name: ladder
+//	    action: include
+//	    mode: ladder
+//	  - name: no-ai
+//	    action: exclude
+//	    mode: vs-ai
+//	  - name: leaves
+//	    action: exclude
+//	    shorter_than: 1m
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replay"
+)
+
+// Set is an ordered list of rules; replays matching no rule are included
+type Set []Rule
+
+// Decision is the outcome of evaluating a Set against a replay
+type Decision struct {
+	// Upload is whether the replay should be uploaded
+	Upload bool
+
+	// Rule is the rule which matched, or nil if none did
+	Rule *Rule
+
+	// Index is the position of Rule in the Set, starting from 1
+	Index int
+
+	// Reasons describe the conditions of Rule that matched
+	Reasons []string
+}
+
+// String explains the decision, such as:
+// excluded by rule "no-ai" (#2): mode is vs-ai
+func (d Decision) String() string {
+	if d.Rule == nil {
+		return "included, no rule matched"
+	}
+
+	verb := "included"
+	if !d.Upload {
+		verb = "excluded"
+	}
+
+	s := fmt.Sprintf("%s by %v (#%d)", verb, *d.Rule, d.Index)
+	if len(d.Reasons) > 0 {
+		s += ": " + strings.Join(d.Reasons, ", ")
+	}
+
+	return s
+}
+
+// Validate returns an error describing the first invalid rule in the set
+func (s Set) Validate() error {
+	for i, r := range s {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("filter #%d: %v", 1+i, err)
+		}
+	}
+
+	return nil
+}
+
+// Evaluate decides whether the replay, saved by the given toon, is uploaded
+func (s Set) Evaluate(replay *sc2replay.Replay, toon string) Decision {
+	for i := range s {
+		if ok, reasons := s[i].Match(replay, toon); ok {
+			return Decision{
+				Upload:  s[i].Action == ActionInclude,
+				Rule:    &s[i],
+				Index:   1 + i,
+				Reasons: reasons,
+			}
+		}
+	}
+
+	return Decision{Upload: true}
+}
@@ -0,0 +1,106 @@
+package rules_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/rules"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replay"
+)
+
+const config = `
+filters:
+  - name: ladder
+    action: include
+    mode: ladder
+  - name: no-ai
+    action: exclude
+    mode: [vs-ai]
+  - name: leaves
+    action: exclude
+    shorter_than: 1m
+  - name: rivals
+    action: exclude
+    opponent: ["rival*", "2-S2-1-*"]
+    matchup: "*vZ"
+  - action: exclude
+    map: "*training*"
+    toon: 1-S2-1-2
+`
+
+const me = "1-S2-1-1"
+
+func newReplay(mode sc2replay.GameMode, length time.Duration, mapName string, opponent sc2replay.Player) *sc2replay.Replay {
+	return &sc2replay.Replay{
+		Map:    mapName,
+		Mode:   mode,
+		Length: length,
+		Players: []sc2replay.Player{
+			{Name: "Me", Toon: sc2replay.Toon{Region: 1, ProgramID: "S2", Realm: 1, ID: 1}, Race: "Protoss", Team: 0},
+			opponent,
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	assert.Nil(t, v.ReadConfig(strings.NewReader(config)), "must not error")
+
+	var set rules.Set
+	assert.Nil(t, v.UnmarshalKey("filters", &set), "must not error")
+	assert.Len(t, set, 5, "must decode every rule")
+	assert.Equal(t, time.Minute, set[2].ShorterThan, "must decode durations")
+	assert.Nil(t, set.Validate(), "must be valid")
+
+	zerg := sc2replay.Player{Name: "RivalZ", Toon: sc2replay.Toon{Region: 1, ProgramID: "S2", Realm: 1, ID: 9}, Race: "Zerg", Team: 1}
+	terran := sc2replay.Player{Name: "Rival", Toon: sc2replay.Toon{Region: 1, ProgramID: "S2", Realm: 1, ID: 8}, Race: "Terran", Team: 1}
+	eu := sc2replay.Player{Name: "Someone", Toon: sc2replay.Toon{Region: 2, ProgramID: "S2", Realm: 1, ID: 7}, Race: "Zerg", Team: 1}
+	ai := sc2replay.Player{Name: "A.I. 1", Race: "Zerg", Team: 1, Control: sc2replay.ControlComputer}
+
+	var cases = []struct {
+		Name   string
+		Replay *sc2replay.Replay
+		Toon   string
+		Upload bool
+		Index  int
+	}{
+		{"ladder leave", newReplay(sc2replay.ModeLadder, 30*time.Second, "Ever Dream LE", zerg), me, true, 1},
+		{"vs ai", newReplay(sc2replay.ModeVersusAI, 10*time.Minute, "Ever Dream LE", ai), me, false, 2},
+		{"custom leave", newReplay(sc2replay.ModeCustom, 59*time.Second, "Ever Dream LE", terran), me, false, 3},
+		{"custom rival zerg", newReplay(sc2replay.ModeCustom, 5*time.Minute, "Ever Dream LE", zerg), me, false, 4},
+		{"custom rival terran", newReplay(sc2replay.ModeCustom, 5*time.Minute, "Ever Dream LE", terran), me, true, 0},
+		{"custom zerg by toon", newReplay(sc2replay.ModeCustom, 5*time.Minute, "Ever Dream LE", eu), me, false, 4},
+		{"training other toon", newReplay(sc2replay.ModeUnknown, 5*time.Minute, "Training Day", terran), "1-S2-1-2", false, 5},
+		{"training", newReplay(sc2replay.ModeUnknown, 5*time.Minute, "Training Day", terran), me, true, 0},
+	}
+
+	for _, c := range cases {
+		d := set.Evaluate(c.Replay, c.Toon)
+		assert.Equal(t, c.Upload, d.Upload, "upload must match: %v: %v", c.Name, d)
+		assert.Equal(t, c.Index, d.Index, "matched rule must match: %v: %v", c.Name, d)
+	}
+
+	d := set.Evaluate(newReplay(sc2replay.ModeVersusAI, time.Minute, "", ai), me)
+	assert.Equal(t, `excluded by rule "no-ai" (#2): mode is vs-ai`, d.String(), "must explain decision")
+
+	d = set.Evaluate(newReplay(sc2replay.ModeCustom, time.Hour, "", terran), me)
+	assert.Equal(t, "included, no rule matched", d.String(), "must explain decision")
+}
+
+func TestValidate(t *testing.T) {
+	var cases = []rules.Rule{
+		{Action: "upload"},
+		{Action: rules.ActionExclude, Mode: []string{"arcade"}},
+		{Action: rules.ActionExclude, ShorterThan: -time.Second},
+		{Action: rules.ActionExclude, Map: []string{"[unclosed"}},
+	}
+
+	for _, c := range cases {
+		assert.NotNil(t, rules.Set{c}.Validate(), "must be invalid: %+v", c)
+	}
+}
@@ -0,0 +1,46 @@
+package sc2replay
+
+// GameMode describes how a game was set up
+type GameMode string
+
+// GameModes which can be told apart from a replay
+const (
+	// ModeLadder is a game found by matchmaking against other players
+	ModeLadder GameMode = "ladder"
+
+	// ModeCustom is a game created in a custom lobby
+	ModeCustom GameMode = "custom"
+
+	// ModeVersusAI is any game with at least one computer player
+	ModeVersusAI GameMode = "vs-ai"
+
+	// ModeUnknown is a game whose mode could not be determined
+	ModeUnknown GameMode = ""
+)
+
+// decodeGameMode tells the game mode from replay.initData where it was read,
+// or from the game mode attribute otherwise
+func decodeGameMode(attrs attributes, initial *initData, players []Player) GameMode {
+	for _, p := range players {
+		if p.Control == ControlComputer {
+			return ModeVersusAI
+		}
+	}
+
+	if initial != nil {
+		if initial.amm {
+			return ModeLadder
+		}
+
+		return ModeCustom
+	}
+
+	switch attrs.Global(attrGameMode) {
+	case "Amm":
+		return ModeLadder
+	case "Priv", "Pub":
+		return ModeCustom
+	}
+
+	return ModeUnknown
+}
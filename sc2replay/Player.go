@@ -0,0 +1,96 @@
+package sc2replay
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Control describes who controlled a player
+type Control string
+
+// Controls found in replays
+const (
+	ControlHuman    Control = "human"
+	ControlComputer Control = "computer"
+	ControlUnknown  Control = ""
+)
+
+// Result is the outcome of a game for one player
+type Result string
+
+// Results found in replays
+const (
+	ResultVictory Result = "victory"
+	ResultDefeat  Result = "defeat"
+	ResultTie     Result = "tie"
+	ResultUnknown Result = ""
+)
+
+var (
+	controls = map[int64]Control{2: ControlHuman, 3: ControlComputer}
+	results  = map[int64]Result{1: ResultVictory, 2: ResultDefeat, 3: ResultTie}
+)
+
+// Toon identifies a player's Battle.net profile, also known as a character
+type Toon struct {
+	Region    int    `json:"region"`
+	ProgramID string `json:"program_id"`
+	Realm     int    `json:"realm"`
+	ID        int64  `json:"id"`
+}
+
+// String returns the toon handle, in the same format "1-S2-1-1234567" as the
+// folders replays are stored in
+func (t Toon) String() string {
+	return fmt.Sprintf("%d-%s-%d-%d", t.Region, t.ProgramID, t.Realm, t.ID)
+}
+
+// Player is a participant of a game, as listed in replay.details
+type Player struct {
+	Name    string  `json:"name"`
+	Toon    Toon    `json:"toon"`
+	Race    string  `json:"race"`
+	Team    int     `json:"team"`
+	Control Control `json:"control"`
+	Result  Result  `json:"result"`
+
+	// Clan is the player's clan tag, if any
+	Clan string `json:"clan"`
+
+	// MMR is the player's matchmaking rating when the game began, or 0 if the
+	// replay does not tell
+	MMR int `json:"mmr"`
+}
+
+// RaceLetter returns the first letter of the player's race, such as "Z"
+func (p Player) RaceLetter() string {
+	if p.Race == "" {
+		return "?"
+	}
+
+	return strings.ToUpper(p.Race[:1])
+}
+
+func decodePlayer(f fields) Player {
+	toon := f.Struct(1)
+	p := Player{
+		Name: string(f.Bytes(0)),
+		Toon: Toon{
+			Region:    int(toon.Int(0)),
+			ProgramID: strings.TrimRight(toon.String(1), "\x00"),
+			Realm:     int(toon.Int(2)),
+			ID:        toon.Int(3),
+		},
+		Race:    f.String(2),
+		Team:    int(f.Int(5)),
+		Control: controls[f.Int(4)],
+		Result:  results[f.Int(8)],
+	}
+
+	// older protocols stored the toon's name at 3, moving the ID to 4
+	if id, ok := toon[4].(int64); ok {
+		p.Toon.ID = id
+	}
+
+	return p
+}
@@ -0,0 +1,271 @@
+// Package sc2replay reads the metadata of StarCraft II replays, which are
+// MPQ archives (see package mpq) holding a number of encoded files.
+//
+// The replay header and replay.details use a self-describing encoding which
+// is stable across game versions, so they are decoded without needing the
+// protocol definitions of each build. replay.initData on the other hand is
+// bit-packed in a layout that changes between builds, so only its start is
+// read: each user's clan tag and rating, and whether the game was matchmade,
+// following s2protocol's definitions of builds since 2.1. For older builds,
+// the game mode is taken from replay.attributes.events alone, which holds the
+// same lobby settings in a simple, stable format.
+package sc2replay
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/mpq"
+)
+
+// file names within the replay archive
+const (
+	fileAttributes = "replay.attributes.events"
+	fileDetails    = "replay.details"
+	fileInitData   = "replay.initData"
+)
+
+// loopsPerSecond at each game speed, as stored in replay.details
+var loopsPerSecond = []float64{16 * .6, 16 * .8, 16, 16 * 1.2, 16 * 1.4}
+
+// gameSpeeds maps the game speed attribute to an index of loopsPerSecond
+var gameSpeeds = map[string]int64{"Slor": 0, "Slow": 1, "Norm": 2, "Fast": 3, "Fasr": 4}
+
+// ErrNotReplay means the file is an MPQ archive, but not a StarCraft II replay
+var ErrNotReplay = errors.New("not a StarCraft II replay")
+
+// Replay is the metadata of a StarCraft II replay
+type Replay struct {
+	// Version is that of the game the replay was recorded with
+	Version Version `json:"version"`
+
+	// Map is the title of the map played, as shown in game
+	Map string `json:"map"`
+
+	// Players lists everyone who took part in the game
+	Players []Player `json:"players"`
+
+	// Mode describes how the game was set up
+	Mode GameMode `json:"mode"`
+
+	// Ranked is whether a ladder game counted towards the players' ranking
+	Ranked bool `json:"ranked"`
+
+	// Format is the team setup of the game, such as "1v1"
+	Format string `json:"format"`
+
+	// GameLoops is the length of the game in game loops
+	GameLoops int64 `json:"game_loops"`
+
+	// Length is the length of the game in real time
+	Length time.Duration `json:"length"`
+
+	// Played is when the game ended
+	Played time.Time `json:"played"`
+
+	// BlizzardMap is whether the map was published by Blizzard
+	BlizzardMap bool `json:"blizzard_map"`
+}
+
+// Open reads the metadata of the replay in the named file
+func Open(filename string) (*Replay, error) {
+	a, err := mpq.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open replay: %w", err)
+	}
+	defer a.Close()
+
+	return decode(a)
+}
+
+// Read reads the metadata of the replay of the given size from r
+func Read(r io.ReaderAt, size int64) (*Replay, error) {
+	a, err := mpq.NewArchive(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("read replay: %w", err)
+	}
+
+	return decode(a)
+}
+
+func decode(a *mpq.Archive) (*Replay, error) {
+	if len(a.UserData) == 0 {
+		return nil, ErrNotReplay
+	}
+
+	h, err := decodeVersioned(a.UserData)
+	if err != nil {
+		return nil, fmt.Errorf("replay header: %w", err)
+	}
+
+	header := asFields(h)
+	if !strings.HasPrefix(header.String(0), "StarCraft II replay") {
+		return nil, ErrNotReplay
+	}
+
+	version := header.Struct(1)
+	r := &Replay{
+		Version: Version{
+			Major:     int(version.Int(1)),
+			Minor:     int(version.Int(2)),
+			Revision:  int(version.Int(3)),
+			Build:     int(version.Int(4)),
+			BaseBuild: int(version.Int(5)),
+		},
+		GameLoops: header.Int(3),
+		Players:   make([]Player, 0),
+	}
+
+	data, err := a.ReadFile(fileDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := decodeVersioned(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", fileDetails, err)
+	}
+
+	details := asFields(d)
+	r.Map = details.String(1)
+	r.BlizzardMap = details.Int(4) != 0
+	r.Played = fileTime(details.Int(5))
+
+	for _, p := range details.Array(0) {
+		if f := asFields(p); f != nil {
+			r.Players = append(r.Players, decodePlayer(f))
+		}
+	}
+
+	attrs := make(attributes)
+	if data, err = a.ReadFile(fileAttributes); err == nil {
+		if attrs, err = decodeAttributes(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", fileAttributes, err)
+		}
+	} else if !errors.Is(err, mpq.ErrNotFound) {
+		return nil, err
+	}
+
+	var initial *initData
+	if data, err = a.ReadFile(fileInitData); err == nil {
+		initial, err = decodeInitData(data, r.Version.BaseBuild)
+		if err != nil && !errors.Is(err, errUnsupportedBuild) {
+			return nil, fmt.Errorf("%s: %w", fileInitData, err)
+		}
+	} else if !errors.Is(err, mpq.ErrNotFound) {
+		return nil, err
+	}
+
+	if initial != nil {
+		r.Ranked = initial.amm && initial.competitive
+
+		for i, p := range r.Players {
+			if u := initial.user(p.Toon.String()); u != nil {
+				r.Players[i].Clan = u.clanTag
+				if u.hasRating {
+					r.Players[i].MMR = int(u.scaledRating)
+				}
+			}
+		}
+	}
+
+	r.Format = attrs.Global(attrFormat)
+	r.Mode = decodeGameMode(attrs, initial, r.Players)
+
+	speed, ok := details.Int(12), details[12] != nil
+	if s, found := gameSpeeds[attrs.Global(attrGameSpeed)]; !ok && found {
+		speed, ok = s, true
+	}
+
+	if !ok || speed < 0 || speed >= int64(len(loopsPerSecond)) {
+		speed = int64(len(loopsPerSecond) - 1) // Faster, which ladder uses
+	}
+
+	r.Length = time.Duration(float64(r.GameLoops) / loopsPerSecond[speed] * float64(time.Second)).Round(time.Second)
+
+	return r, nil
+}
+
+// Matchup returns the races of each team, such as "PvZ" or "TTvPZ"
+func (r *Replay) Matchup() string {
+	return r.matchup(r.Players)
+}
+
+// MatchupOf returns the races of each team like Matchup, but starting with
+// the team of the player with the given toon handle
+func (r *Replay) MatchupOf(toon string) string {
+	p := r.Player(toon)
+	if p == nil {
+		return r.Matchup()
+	}
+
+	players := []Player{*p}
+	for _, o := range r.Players {
+		if o.Toon != p.Toon {
+			players = append(players, o)
+		}
+	}
+
+	return r.matchup(players)
+}
+
+// Opponents returns the players not on the team of the player with the given
+// toon handle, or every player if they did not take part in the game
+func (r *Replay) Opponents(toon string) []Player {
+	p := r.Player(toon)
+	opponents := make([]Player, 0, len(r.Players))
+
+	for _, o := range r.Players {
+		if p == nil || o.Team != p.Team {
+			opponents = append(opponents, o)
+		}
+	}
+
+	return opponents
+}
+
+func (r *Replay) matchup(players []Player) string {
+	teams := make(map[int]string)
+	order := make([]int, 0)
+
+	for _, p := range players {
+		if _, ok := teams[p.Team]; !ok {
+			order = append(order, p.Team)
+		}
+
+		teams[p.Team] += p.RaceLetter()
+	}
+
+	parts := make([]string, len(order))
+	for i, team := range order {
+		parts[i] = teams[team]
+	}
+
+	return strings.Join(parts, "v")
+}
+
+// Player returns the player with the given toon handle (see Toon.String), or
+// nil if they did not take part in the game
+func (r *Replay) Player(toon string) *Player {
+	for i, p := range r.Players {
+		if p.Toon.String() == toon {
+			return &r.Players[i]
+		}
+	}
+
+	return nil
+}
+
+// fileTime converts a Windows FILETIME (100ns intervals since 1601) to a time
+func fileTime(ft int64) time.Time {
+	if ft == 0 {
+		return time.Time{}
+	}
+
+	const epochDiff = 116444736000000000 // 1601 to 1970 in 100ns intervals
+
+	return time.Unix(0, (ft-epochDiff)*100).UTC()
+}
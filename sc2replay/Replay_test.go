@@ -0,0 +1,92 @@
+package sc2replay_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqtest"
+	"github.com/AlbinoGeek/sc2-rsu/mpq"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replay"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+func TestOpenGolden(t *testing.T) {
+	replays, err := filepath.Glob(filepath.Join("testdata", "*.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+	assert.NotEmpty(t, replays, "must have sample replays")
+
+	for _, name := range replays {
+		golden := strings.TrimSuffix(name, ".SC2Replay") + ".golden.json"
+
+		t.Run(filepath.Base(name), func(t *testing.T) {
+			r, err := sc2replay.Open(name)
+			if !assert.Nil(t, err, "must not error") {
+				return
+			}
+
+			got, err := json.MarshalIndent(r, "", "  ")
+			assert.Nil(t, err, "must not error")
+			got = append(got, '\n')
+
+			if *update {
+				assert.Nil(t, ioutil.WriteFile(golden, got, 0644), "must write golden file")
+			}
+
+			want, err := ioutil.ReadFile(golden)
+			assert.Nil(t, err, "golden file must exist (run with -update)")
+			assert.Equal(t, string(want), string(got), "must match golden file")
+		})
+	}
+}
+
+func TestReplayHelpers(t *testing.T) {
+	r, err := sc2replay.Open(filepath.Join("testdata", "ladder-1v1.SC2Replay"))
+	if !assert.Nil(t, err, "must not error") {
+		return
+	}
+
+	assert.Equal(t, "PvZ", r.Matchup())
+	assert.Equal(t, "ZvP", r.MatchupOf("1-S2-1-7654321"))
+	assert.Len(t, r.Opponents("1-S2-1-1234567"), 1)
+	assert.Equal(t, "Opponent", r.Opponents("1-S2-1-1234567")[0].Name)
+	assert.Equal(t, "5.0.5.81433", r.Version.String())
+	assert.Equal(t, sc2replay.ModeLadder, r.Mode)
+	assert.True(t, r.Ranked, "matchmade competitive games must be ranked")
+	assert.Equal(t, "ALBN", r.Player("1-S2-1-1234567").Clan, "clan tags must be read from initData")
+
+	p := r.Player("1-S2-1-7654321")
+	if assert.NotNil(t, p, "must find player by toon") {
+		assert.Equal(t, "Opponent", p.Name)
+		assert.Equal(t, sc2replay.ResultDefeat, p.Result)
+		assert.Equal(t, 4188, p.MMR, "ratings must be read from initData")
+	}
+
+	assert.Nil(t, r.Player("1-S2-1-1"), "unknown toons must not match")
+}
+
+func TestReadErrors(t *testing.T) {
+	_, err := sc2replay.Read(bytes.NewReader([]byte("not an archive")), 14)
+	assert.True(t, errors.Is(err, mpq.ErrNotArchive), "garbage must not be an archive")
+
+	var buf bytes.Buffer
+	assert.Nil(t, mpqtest.Write(&buf, nil, []mpqtest.File{{Name: "replay.details", Data: []byte{0}}}))
+	_, err = sc2replay.Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.True(t, errors.Is(err, sc2replay.ErrNotReplay), "archives without a header must not be replays")
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "ladder-1v1.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+
+	for _, size := range []int{len(data) / 2, 1200, 64} {
+		_, err = sc2replay.Read(bytes.NewReader(data[:size]), int64(size))
+		assert.NotNil(t, err, "truncated replays must error")
+	}
+}
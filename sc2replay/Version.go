@@ -0,0 +1,17 @@
+package sc2replay
+
+import "fmt"
+
+// Version is the version of StarCraft II a replay was recorded with
+type Version struct {
+	Major     int `json:"major"`
+	Minor     int `json:"minor"`
+	Revision  int `json:"revision"`
+	Build     int `json:"build"`
+	BaseBuild int `json:"base_build"`
+}
+
+// String returns the version in the format "5.0.5.81433"
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Revision, v.Build)
+}
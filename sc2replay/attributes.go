@@ -0,0 +1,62 @@
+package sc2replay
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// attribute IDs found in replay.attributes.events
+const (
+	attrFormat    = 2001 // "1v1", "2v2", ..., "FFA"
+	attrGameSpeed = 3000 // "Slor", "Slow", "Norm", "Fast" or "Fasr"
+	attrGameMode  = 3009 // "Priv", "Pub" or "Amm"
+)
+
+// scopeGlobal is the scope of attributes that apply to the whole game
+const scopeGlobal = 16
+
+// attributes maps scope (16 for global, otherwise player slot) and attribute
+// ID to the attribute's value
+type attributes map[uint8]map[uint32]string
+
+func (a attributes) Global(id uint32) string {
+	return a[scopeGlobal][id]
+}
+
+// decodeAttributes decodes replay.attributes.events, which unlike most of a
+// replay is a simple list of fixed size little-endian records
+func decodeAttributes(data []byte) (attributes, error) {
+	attrs := make(attributes)
+
+	if len(data) == 0 {
+		return attrs, nil
+	}
+
+	// source u8, map namespace u32, count u32
+	const headerSize = 9
+	const recordSize = 13
+
+	if len(data) < headerSize {
+		return nil, fmt.Errorf("%w: attributes header", errCorrupt)
+	}
+
+	for data = data[headerSize:]; len(data) >= recordSize; data = data[recordSize:] {
+		// namespace u32, attribute u32, scope u8, value [4]byte (reversed)
+		id := binary.LittleEndian.Uint32(data[4:])
+		scope := data[8]
+
+		value := make([]byte, 4)
+		for i := range value {
+			value[i] = data[12-i]
+		}
+
+		if attrs[scope] == nil {
+			attrs[scope] = make(map[uint32]string)
+		}
+
+		attrs[scope][id] = string(bytes.Trim(value, "\x00"))
+	}
+
+	return attrs, nil
+}
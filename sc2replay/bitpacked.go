@@ -0,0 +1,116 @@
+package sc2replay
+
+import "fmt"
+
+// bitPacked reads the bit-packed encoding replay.initData is stored in, which
+// unlike the versioned encoding has no types or tags: each value is as many
+// bits as the protocol of its build says, so it must be read field by field.
+//
+// Bits are taken from the lowest of each byte first, but values are stored
+// most significant bits first, as in s2protocol's BitPackedBuffer.
+type bitPacked struct {
+	data     []byte
+	pos      int
+	next     byte
+	nextBits uint
+}
+
+// bits reads an unsigned value n bits long, at most 64
+func (d *bitPacked) bits(n uint) (uint64, error) {
+	var result uint64
+
+	for read := uint(0); read < n; {
+		if d.nextBits == 0 {
+			if d.pos >= len(d.data) {
+				return 0, fmt.Errorf("%w: unexpected end", errCorrupt)
+			}
+
+			d.next, d.nextBits = d.data[d.pos], 8
+			d.pos++
+		}
+
+		copyBits := n - read
+		if copyBits > d.nextBits {
+			copyBits = d.nextBits
+		}
+
+		result |= uint64(d.next&(1<<copyBits-1)) << (n - read - copyBits)
+		d.next >>= copyBits
+		d.nextBits -= copyBits
+		read += copyBits
+	}
+
+	return result, nil
+}
+
+// int reads an integer stored in n bits as the difference from min
+func (d *bitPacked) int(min int64, n uint) (int64, error) {
+	v, err := d.bits(n)
+	return min + int64(v), err
+}
+
+func (d *bitPacked) bool() (bool, error) {
+	v, err := d.bits(1)
+	return v != 0, err
+}
+
+// optional reads whether an optional value is present, which then follows
+func (d *bitPacked) optional() (bool, error) {
+	return d.bool()
+}
+
+// optionalInt reads an optional integer like int, and whether it is present
+func (d *bitPacked) optionalInt(min int64, n uint) (int64, bool, error) {
+	set, err := d.optional()
+	if err != nil || !set {
+		return 0, false, err
+	}
+
+	v, err := d.int(min, n)
+
+	return v, true, err
+}
+
+// optionalBlob reads an optional blob like blob, or nil if it is not present
+func (d *bitPacked) optionalBlob(n uint) ([]byte, error) {
+	set, err := d.optional()
+	if err != nil || !set {
+		return nil, err
+	}
+
+	return d.blob(n)
+}
+
+// optionalBytes reads n optional bytes like bytes, or nil if not present
+func (d *bitPacked) optionalBytes(n int) ([]byte, error) {
+	set, err := d.optional()
+	if err != nil || !set {
+		return nil, err
+	}
+
+	return d.bytes(n)
+}
+
+// blob reads a length of n bits, followed by that many bytes, which begin at
+// the next byte
+func (d *bitPacked) blob(n uint) ([]byte, error) {
+	length, err := d.bits(n)
+	if err != nil {
+		return nil, err
+	}
+
+	return d.bytes(int(length))
+}
+
+// bytes reads n bytes, beginning at the next byte
+func (d *bitPacked) bytes(n int) ([]byte, error) {
+	d.nextBits = 0
+
+	if n > len(d.data)-d.pos {
+		return nil, fmt.Errorf("%w: unexpected end", errCorrupt)
+	}
+
+	d.pos += n
+
+	return d.data[d.pos-n : d.pos], nil
+}
@@ -0,0 +1,210 @@
+package sc2replay
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// errCorrupt means versioned data ended early or was otherwise malformed
+var errCorrupt = errors.New("corrupt versioned data")
+
+// versioned decodes the self-describing "versioned" encoding, which the
+// replay header and replay.details are stored in, into plain values:
+//
+//	array, choice, optional -> []interface{}, the value, nil or the value
+//	bitarray, blob, fourcc  -> []byte
+//	struct                  -> map[int64]interface{}, keyed by field tag
+//	integers                -> int64
+type versioned struct {
+	data []byte
+	pos  int
+}
+
+func decodeVersioned(data []byte) (interface{}, error) {
+	d := &versioned{data: data}
+	return d.value(0)
+}
+
+func (d *versioned) value(depth int) (interface{}, error) {
+	if depth > 32 {
+		return nil, fmt.Errorf("%w: nested too deeply", errCorrupt)
+	}
+
+	tag, err := d.byte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tag {
+	case 0x00: // array
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		arr := make([]interface{}, n)
+		for i := range arr {
+			if arr[i], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return arr, nil
+	case 0x01: // bitarray
+		n, err := d.vint()
+		if err != nil {
+			return nil, err
+		}
+
+		return d.bytes((n + 7) / 8)
+	case 0x02: // blob
+		n, err := d.vint()
+		if err != nil {
+			return nil, err
+		}
+
+		return d.bytes(n)
+	case 0x03: // choice
+		if _, err := d.vint(); err != nil {
+			return nil, err
+		}
+
+		return d.value(depth + 1)
+	case 0x04: // optional
+		exists, err := d.byte()
+		if err != nil || exists == 0 {
+			return nil, err
+		}
+
+		return d.value(depth + 1)
+	case 0x05: // struct
+		n, err := d.length()
+		if err != nil {
+			return nil, err
+		}
+
+		fields := make(map[int64]interface{}, n)
+		for i := int64(0); i < n; i++ {
+			field, err := d.vint()
+			if err != nil {
+				return nil, err
+			}
+
+			if fields[field], err = d.value(depth + 1); err != nil {
+				return nil, err
+			}
+		}
+
+		return fields, nil
+	case 0x06: // u8
+		b, err := d.byte()
+		return int64(b), err
+	case 0x07: // u32, used for fourcc
+		return d.bytes(4)
+	case 0x08: // u64
+		b, err := d.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case 0x09: // vint
+		return d.vint()
+	}
+
+	return nil, fmt.Errorf("%w: unknown type %#x at %d", errCorrupt, tag, d.pos-1)
+}
+
+func (d *versioned) byte() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, fmt.Errorf("%w: unexpected end", errCorrupt)
+	}
+
+	d.pos++
+
+	return d.data[d.pos-1], nil
+}
+
+func (d *versioned) bytes(n int64) ([]byte, error) {
+	if n < 0 || n > int64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("%w: unexpected end", errCorrupt)
+	}
+
+	d.pos += int(n)
+
+	return d.data[d.pos-int(n) : d.pos], nil
+}
+
+// length reads a vint which is a count of following values, each of which
+// takes at least one byte, so that corrupt data cannot cause huge allocations
+func (d *versioned) length() (int64, error) {
+	n, err := d.vint()
+	if err == nil && (n < 0 || n > int64(len(d.data)-d.pos)) {
+		err = fmt.Errorf("%w: bad length %d", errCorrupt, n)
+	}
+
+	return n, err
+}
+
+// vint reads a variable length integer, stored 7 bits per byte, with the
+// lowest bit of the first byte being the sign
+func (d *versioned) vint() (int64, error) {
+	b, err := d.byte()
+	if err != nil {
+		return 0, err
+	}
+
+	negative := b&1 != 0
+	result := int64(b>>1) & 0x3F
+
+	for shift := uint(6); b&0x80 != 0; shift += 7 {
+		if shift > 63 {
+			return 0, fmt.Errorf("%w: vint too long", errCorrupt)
+		}
+
+		if b, err = d.byte(); err != nil {
+			return 0, err
+		}
+
+		result |= int64(b&0x7F) << shift
+	}
+
+	if negative {
+		return -result, nil
+	}
+
+	return result, nil
+}
+
+// fields is a decoded versioned struct, with typed accessors which return
+// the zero value for fields which are missing or of another type
+type fields map[int64]interface{}
+
+func asFields(v interface{}) fields {
+	f, _ := v.(map[int64]interface{})
+	return f
+}
+
+func (f fields) Int(tag int64) int64 {
+	v, _ := f[tag].(int64)
+	return v
+}
+
+func (f fields) Bytes(tag int64) []byte {
+	v, _ := f[tag].([]byte)
+	return v
+}
+
+func (f fields) String(tag int64) string {
+	return string(f.Bytes(tag))
+}
+
+func (f fields) Struct(tag int64) fields {
+	return asFields(f[tag])
+}
+
+func (f fields) Array(tag int64) []interface{} {
+	v, _ := f[tag].([]interface{})
+	return v
+}
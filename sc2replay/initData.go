@@ -0,0 +1,154 @@
+package sc2replay
+
+import (
+	"errors"
+	"math"
+)
+
+// base builds from which replay.initData gained the fields read from it
+const (
+	buildToonHandle   = 34784 // 2.1: test type, hero, skin, mount, toon handle
+	buildScaledRating = 54518 // 3.11: the scaled rating (MMR) of each user
+)
+
+// errUnsupportedBuild means replay.initData of the replay's build has a
+// layout which is not known, and was not decoded
+var errUnsupportedBuild = errors.New("unsupported build")
+
+// userInitData is what is read of each user in replay.initData
+type userInitData struct {
+	clanTag      string
+	toonHandle   string
+	scaledRating int64
+	hasRating    bool
+}
+
+// initData is what is read of replay.initData: the initial data of each user
+// and the game options, which come first in it; the rest of the lobby state
+// after them is not read, as it differs most between builds
+type initData struct {
+	users       []userInitData
+	battleNet   bool
+	amm         bool
+	competitive bool
+}
+
+// decodeInitData decodes the start of replay.initData, following the protocol
+// of the given base build, as defined by s2protocol
+func decodeInitData(data []byte, baseBuild int) (*initData, error) {
+	if baseBuild < buildToonHandle {
+		return nil, errUnsupportedBuild
+	}
+
+	d := &bitPacked{data: data}
+
+	n, err := d.bits(5)
+	if err != nil {
+		return nil, err
+	}
+
+	initial := &initData{users: make([]userInitData, n)}
+	for i := range initial.users {
+		if initial.users[i], err = decodeUserInitData(d, baseBuild); err != nil {
+			return nil, err
+		}
+	}
+
+	// game description: random value, game cache name, then the options
+	if _, err = d.bits(32); err != nil {
+		return nil, err
+	}
+
+	if _, err = d.blob(10); err != nil {
+		return nil, err
+	}
+
+	// lock teams, teams together, advanced shared control, random races
+	if _, err = d.bits(4); err != nil {
+		return nil, err
+	}
+
+	for _, b := range []*bool{&initial.battleNet, &initial.amm, &initial.competitive} {
+		if *b, err = d.bool(); err != nil {
+			return nil, err
+		}
+	}
+
+	return initial, nil
+}
+
+func decodeUserInitData(d *bitPacked, baseBuild int) (u userInitData, err error) {
+	// name
+	if _, err = d.blob(8); err != nil {
+		return
+	}
+
+	clanTag, err := d.optionalBlob(8)
+	if err != nil {
+		return
+	}
+
+	u.clanTag = string(clanTag)
+
+	// clan logo (a cache handle), highest league, combined race levels
+	if _, err = d.optionalBytes(40); err != nil {
+		return
+	}
+
+	if _, _, err = d.optionalInt(0, 8); err != nil {
+		return
+	}
+
+	if _, _, err = d.optionalInt(0, 32); err != nil {
+		return
+	}
+
+	// random seed, then race and team preference
+	if _, err = d.bits(32); err != nil {
+		return
+	}
+
+	if _, _, err = d.optionalInt(0, 8); err != nil {
+		return
+	}
+
+	if _, _, err = d.optionalInt(0, 8); err != nil {
+		return
+	}
+
+	// test map, test auto, examine, custom interface, test type, observe
+	if _, err = d.bits(4 + 32 + 2); err != nil {
+		return
+	}
+
+	// hero, skin and mount
+	for i := 0; i < 3; i++ {
+		if _, err = d.blob(9); err != nil {
+			return
+		}
+	}
+
+	toon, err := d.blob(7)
+	if err != nil {
+		return
+	}
+
+	u.toonHandle = string(toon)
+
+	if baseBuild >= buildScaledRating {
+		u.scaledRating, u.hasRating, err = d.optionalInt(math.MinInt32, 32)
+	}
+
+	return
+}
+
+// user returns the initial data of the user with the given toon handle
+func (initial *initData) user(toon string) *userInitData {
+	for i, u := range initial.users {
+		if u.toonHandle == toon {
+			return &initial.users[i]
+		}
+	}
+
+	return nil
+}
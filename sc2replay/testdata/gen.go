@@ -0,0 +1,382 @@
+//go:build ignore
+// +build ignore
+
+// This program generates the sample replays used by the golden tests. They
+// are synthetic, holding only the files and fields sc2replay decodes, so
+// that no player's real replays need to be checked in. As they are written by
+// package mpqtest and this program, they cannot catch a misreading of the
+// format shared by both sides; real ladder, vs. AI and custom replays, with
+// golden files checked against s2protocol, are still needed for that. Run
+// from sc2replay:
+//
+//	go run testdata/gen.go && go test -update
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/internal/mpqtest"
+)
+
+type (
+	fourcc   string
+	optional struct{ v interface{} }
+	field    struct {
+		tag int
+		v   interface{}
+	}
+	record []field
+)
+
+func vint(v int64) []byte {
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+
+	b := byte(v&0x3F) << 1
+	if neg {
+		b |= 1
+	}
+
+	out := []byte{}
+	for v >>= 6; v > 0; v >>= 7 {
+		out = append(out, b|0x80)
+		b = byte(v & 0x7F)
+	}
+
+	return append(out, b)
+}
+
+func enc(v interface{}) []byte {
+	switch t := v.(type) {
+	case int:
+		return append([]byte{0x09}, vint(int64(t))...)
+	case int64:
+		return append([]byte{0x09}, vint(t)...)
+	case bool:
+		if t {
+			return []byte{0x06, 1}
+		}
+		return []byte{0x06, 0}
+	case string:
+		return append(append([]byte{0x02}, vint(int64(len(t)))...), t...)
+	case fourcc:
+		b := make([]byte, 4)
+		copy(b, t)
+		return append([]byte{0x07}, b...)
+	case optional:
+		if t.v == nil {
+			return []byte{0x04, 0}
+		}
+		return append([]byte{0x04, 1}, enc(t.v)...)
+	case []interface{}:
+		out := append([]byte{0x00}, vint(int64(len(t)))...)
+		for _, e := range t {
+			out = append(out, enc(e)...)
+		}
+		return out
+	case record:
+		out := append([]byte{0x05}, vint(int64(len(t)))...)
+		for _, f := range t {
+			out = append(out, vint(int64(f.tag))...)
+			out = append(out, enc(f.v)...)
+		}
+		return out
+	}
+
+	panic("cannot encode value")
+}
+
+// bits writes the bit-packed encoding of replay.initData, the reverse of
+// sc2replay's bitPacked reader
+type bits struct {
+	out  []byte
+	free uint
+}
+
+func (b *bits) int(v uint64, n uint) {
+	for n > 0 {
+		if b.free == 0 {
+			b.out = append(b.out, 0)
+			b.free = 8
+		}
+
+		chunk := n
+		if chunk > b.free {
+			chunk = b.free
+		}
+
+		part := byte(v>>(n-chunk)) & (1<<chunk - 1)
+		b.out[len(b.out)-1] |= part << (8 - b.free)
+		b.free -= chunk
+		n -= chunk
+	}
+}
+
+func (b *bits) bool(v bool) {
+	if v {
+		b.int(1, 1)
+	} else {
+		b.int(0, 1)
+	}
+}
+
+func (b *bits) bytes(v string) {
+	b.free = 0
+	b.out = append(b.out, v...)
+}
+
+func (b *bits) blob(v string, n uint) {
+	b.int(uint64(len(v)), n)
+	b.bytes(v)
+}
+
+type player struct {
+	name    string
+	region  int
+	realm   int
+	id      int64
+	race    string
+	team    int
+	control int
+	result  int
+	clan    string
+	mmr     int64
+}
+
+type sample struct {
+	name     string
+	build    int
+	loops    int64
+	title    string
+	played   time.Time
+	mode     string
+	format   string
+	amm      bool
+	players  []player
+	legacy   bool // toon name stored at field 3, ID at 4
+	noAttrs  bool
+	detailsA bool // replay.details stored as a single unit
+}
+
+func header(s sample) []byte {
+	return enc(record{
+		{0, "StarCraft II replay\x1b11"},
+		{1, record{{0, 1}, {1, 5}, {2, 0}, {3, 5}, {4, s.build}, {5, s.build}}},
+		{2, 2},
+		{3, s.loops},
+		{4, true},
+	})
+}
+
+func details(s sample) []byte {
+	players := []interface{}{}
+
+	for _, p := range s.players {
+		toon := record{{0, p.region}, {1, fourcc("S2")}, {2, p.realm}, {3, p.id}}
+		if s.legacy {
+			toon = record{{0, p.region}, {1, fourcc("S2")}, {2, p.realm}, {3, p.name}, {4, p.id}}
+		}
+
+		players = append(players, record{
+			{0, p.name},
+			{1, toon},
+			{2, p.race},
+			{3, record{{0, 255}, {1, 180}, {2, 20}, {3, 30}}},
+			{4, p.control},
+			{5, p.team},
+			{6, 100},
+			{7, 0},
+			{8, p.result},
+			{9, optional{}},
+			{10, ""},
+		})
+	}
+
+	filetime := s.played.UnixNano()/100 + 116444736000000000
+
+	return enc(record{
+		{0, optional{players}},
+		{1, s.title},
+		{2, ""},
+		{3, record{{0, "Minimap.tga"}}},
+		{4, true},
+		{5, filetime},
+		{6, int64(-8 * time.Hour / 100)},
+		{7, ""},
+		{8, ""},
+		{9, ""},
+		{10, optional{}},
+		{11, false},
+		{12, 4},
+		{13, 7},
+	})
+}
+
+// initData writes the user initial data and game options of replay.initData,
+// as laid out by the protocol of builds since 3.11
+func initData(s sample) []byte {
+	if s.build < 54518 {
+		return bytes.Repeat([]byte{0}, 64)
+	}
+
+	b := &bits{}
+
+	var humans []player
+	for _, p := range s.players {
+		if p.control == 2 {
+			humans = append(humans, p)
+		}
+	}
+
+	b.int(uint64(len(humans)), 5)
+
+	for _, p := range humans {
+		b.blob(p.name, 8)
+		b.bool(p.clan != "")
+		if p.clan != "" {
+			b.blob(p.clan, 8)
+		}
+
+		b.bool(false)       // clan logo
+		b.bool(true)        // highest league
+		b.int(5, 8)         // ...diamond
+		b.bool(false)       // combined race levels
+		b.int(0xC0FFEE, 32) // random seed
+		b.bool(false)       // race preference
+		b.bool(false)       // team preference
+		b.int(0, 4+32+2)    // test map, test auto, examine, custom interface, test type, observe
+		b.blob("", 9)       // hero
+		b.blob("", 9)       // skin
+		b.blob("", 9)       // mount
+		b.blob(fmt.Sprintf("%d-S2-%d-%d", p.region, p.realm, p.id), 7)
+		b.bool(p.mmr != 0)
+		if p.mmr != 0 {
+			b.int(uint64(p.mmr+1<<31), 32)
+		}
+	}
+
+	b.int(0xDEADBEEF, 32) // random value
+	b.blob("Dflt", 10)    // game cache name
+
+	// lock teams, teams together, advanced shared control, random races,
+	// battle.net, amm, competitive, practice, cooperative, no victory or
+	// defeat, hero duplicates allowed, fog, observers, user difficulty,
+	// client debug flags, build coach enabled
+	for _, v := range []bool{true, true, false, false, true, s.amm, s.amm, false, false, false, false} {
+		b.bool(v)
+	}
+
+	b.int(0, 2+2+2)
+	b.int(0, 64)
+	b.bool(false)
+
+	// the rest of the lobby state is not read, nor written
+	return b.out
+}
+
+func attributes(s sample) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(0)
+	binary.Write(&buf, binary.LittleEndian, uint32(999))
+	binary.Write(&buf, binary.LittleEndian, uint32(3))
+
+	attr := func(id uint32, scope uint8, value string) {
+		v := make([]byte, 4)
+		for i := 0; i < len(value); i++ {
+			v[3-i] = value[i]
+		}
+
+		binary.Write(&buf, binary.LittleEndian, uint32(999))
+		binary.Write(&buf, binary.LittleEndian, id)
+		buf.WriteByte(scope)
+		buf.Write(v)
+	}
+
+	attr(2001, 16, s.format)
+	attr(3000, 16, "Fasr")
+	attr(3009, 16, s.mode)
+
+	return buf.Bytes()
+}
+
+var samples = []sample{
+	{
+		name:   "ladder-1v1",
+		build:  81433,
+		loops:  13440,
+		title:  "Ever Dream LE",
+		played: time.Date(2020, 12, 25, 20, 15, 0, 0, time.UTC),
+		mode:   "Amm",
+		format: "1v1",
+		amm:    true,
+		players: []player{
+			{"AlbinoGeek", 1, 1, 1234567, "Protoss", 0, 2, 1, "ALBN", 4321},
+			{"Opponent", 1, 1, 7654321, "Zerg", 1, 2, 2, "", 4188},
+		},
+	},
+	{
+		name:   "vs-ai-leave",
+		build:  81433,
+		loops:  896,
+		title:  "Pillars of Gold LE",
+		played: time.Date(2020, 12, 26, 9, 0, 0, 0, time.UTC),
+		mode:   "Priv",
+		format: "1v1",
+		players: []player{
+			{"AlbinoGeek", 1, 1, 1234567, "Terran", 0, 2, 2, "ALBN", 0},
+			{"A.I. 1 (Very Easy)", 0, 0, 0, "Zerg", 1, 3, 1, "", 0},
+		},
+		detailsA: true,
+	},
+	{
+		name:   "custom-2v2-legacy",
+		build:  16561,
+		loops:  20160,
+		title:  "Ruined Citadel",
+		played: time.Date(2011, 3, 1, 18, 30, 0, 0, time.UTC),
+		mode:   "Pub",
+		format: "2v2",
+		players: []player{
+			{"First", 2, 1, 111, "Terran", 0, 2, 1, "", 0},
+			{"Second", 2, 1, 222, "Terran", 0, 2, 1, "", 0},
+			{"Third", 2, 1, 333, "Protoss", 1, 2, 2, "", 0},
+			{"Fourth", 2, 1, 444, "Zerg", 1, 2, 2, "", 0},
+		},
+		legacy:  true,
+		noAttrs: true,
+	},
+}
+
+func main() {
+	for _, s := range samples {
+		files := []mpqtest.File{
+			{Name: "replay.details", Data: details(s), SingleUnit: s.detailsA},
+			{Name: "replay.initData", Data: initData(s)},
+		}
+
+		if !s.noAttrs {
+			files = append(files, mpqtest.File{Name: "replay.attributes.events", Data: attributes(s)})
+		}
+
+		f, err := os.Create(filepath.Join("testdata", s.name+".SC2Replay"))
+		if err != nil {
+			panic(err)
+		}
+
+		if err = mpqtest.Write(f, header(s), files); err != nil {
+			panic(err)
+		}
+
+		if err = f.Close(); err != nil {
+			panic(err)
+		}
+	}
+}
@@ -1,55 +1,147 @@
 package sc2replaystats
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"runtime"
+	"strings"
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/kataras/golog"
 )
 
-var (
-	// Hostname represents the root domain sc2replaystats is hosted at
-	Hostname = "sc2replaystats.com"
+const (
+	// DefaultAPIRoot is the base URL of the sc2replaystats JSON-ish API, used
+	// by clients not given any WithAPIRoot option
+	DefaultAPIRoot = "https://api.sc2replaystats.com"
 
-	// Protocol represents the HTTP protocol we use when communicating with sc2replaystats
-	Protocol = "https"
+	// DefaultWebRoot is the base URL of the sc2replaystats Website, used by
+	// clients not given any WithWebRoot option
+	DefaultWebRoot = "https://sc2replaystats.com"
+)
+
+// ClientIdentifier represents the "upload_method" shown to sc2replaystats
+var ClientIdentifier = fmt.Sprintf("sc2-rsu-api-%s", runtime.GOOS)
 
-	// APIRoot represents the base URL for requests to the sc2replaystats JSON-ish API
-	APIRoot = fmt.Sprintf("%s://api.%s", Protocol, Hostname)
+// DefaultTimeouts are used by clients not given any WithTimeouts option
+var DefaultTimeouts = Timeouts{
+	Upload:  time.Minute * 5,
+	Status:  time.Second * 15,
+	Account: time.Second * 15,
+}
 
-	// WebRoot represents the base URL for requests to the sc2replaystats Website
-	WebRoot = fmt.Sprintf("%s://%s", Protocol, Hostname)
+// Timeouts limits how long each attempt (see RetryPolicy) of a kind of
+// request may take, including reading the response; zero means no limit
+// other than that of the context given
+type Timeouts struct {
+	// Upload limits UploadReplay, which sends the whole replay file
+	Upload time.Duration
 
-	// ClientIdentifier represents the "upload_method" shown to sc2replaystats
-	ClientIdentifier = fmt.Sprintf("sc2-rsu-api-%s", runtime.GOOS)
-)
+	// Status limits GetReplayStatus
+	Status time.Duration
+
+	// Account limits GetAccountPlayers
+	Account time.Duration
+}
 
 // Client allows you to communicate with the sc2ReplayStats API
 type Client struct {
-	apikey string
-	client *http.Client
+	apikey   string
+	apiRoot  string
+	client   *http.Client
+	retry    RetryPolicy
+	timeouts Timeouts
+	webRoot  string
+}
+
+// Option changes how a Client communicates, see New
+type Option func(*Client)
+
+// WithTimeouts sets how long each kind of request may take
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(client *Client) {
+		client.timeouts = timeouts
+	}
+}
+
+// WithAPIRoot sets the base URL of the API, such as that of a staging mirror
+// or test server
+func WithAPIRoot(apiRoot string) Option {
+	return func(client *Client) {
+		client.apiRoot = strings.TrimSuffix(apiRoot, "/")
+	}
+}
+
+// WithWebRoot sets the base URL of the Website, which links point to
+func WithWebRoot(webRoot string) Option {
+	return func(client *Client) {
+		client.webRoot = strings.TrimSuffix(webRoot, "/")
+	}
+}
+
+// WithHTTPClient sets the http.Client requests are sent with
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(client *Client) {
+		client.client = httpClient
+	}
 }
 
 // New returns an sc2ReplayStats API Client
-func New(apikey string) *Client {
-	return &Client{
-		apikey: apikey,
-		client: &http.Client{
-			Timeout: time.Second * 3,
-		},
+func New(apikey string, opts ...Option) *Client {
+	client := &Client{
+		apikey:   apikey,
+		apiRoot:  DefaultAPIRoot,
+		client:   &http.Client{},
+		retry:    DefaultRetryPolicy,
+		timeouts: DefaultTimeouts,
+		webRoot:  DefaultWebRoot,
+	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
+}
+
+// APIRoot returns the base URL of the API the client sends requests to
+func (client *Client) APIRoot() string {
+	return client.apiRoot
+}
+
+// WebRoot returns the base URL of the Website belonging to the API
+func (client *Client) WebRoot() string {
+	return client.webRoot
+}
+
+// ReplayURL returns the address of a replay's page on the Website
+func (client *Client) ReplayURL(replayID string) string {
+	return fmt.Sprintf("%s/replay/%s", client.webRoot, replayID)
+}
+
+// withTimeout returns ctx limited to the given timeout, unless it is zero
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+
+	return context.WithTimeout(ctx, timeout)
 }
 
-func (client *Client) doRequest(method, slug, contentType string, data io.Reader) (resp *http.Response, err error) {
-	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", APIRoot, slug), data)
+func (client *Client) doRequest(ctx context.Context, method, slug, contentType string, data io.Reader, size int64) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, method, fmt.Sprintf("%s/%s", client.apiRoot, slug), data)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare request: %v", err)
 	}
 
+	if size >= 0 {
+		req.ContentLength = size
+	}
+
 	req.Header.Set("Authorization", client.apikey)
 
 	if contentType != "" {
@@ -58,45 +150,99 @@ func (client *Client) doRequest(method, slug, contentType string, data io.Reader
 
 	resp, err = client.client.Do(req)
 	if err != nil {
-		err = fmt.Errorf("failed to send request: %v", err)
+		err = fmt.Errorf("failed to send request: %w", err)
 	}
 
 	return
 }
 
-func (client *Client) requestBytes(method, slug, contentType string, data io.Reader) (result []byte, err error) {
-	resp, err := client.doRequest(method, slug, contentType, data)
+// request sends a request, retrying it as the client's RetryPolicy allows
+// while it fails for reasons which may be temporary; body (if not nil) is
+// called for every attempt and must return the whole request body each time,
+// along with its size (or -1 if unknown)
+func (client *Client) request(ctx context.Context, timeout time.Duration, method, slug, contentType string, body func() (io.Reader, int64)) (result []byte, err error) {
+	for retry := 1; ; retry++ {
+		var (
+			resp *http.Response
+			sent bool
+		)
+
+		result, resp, sent, err = client.attempt(ctx, timeout, method, slug, contentType, body)
+
+		f := classify(resp, err)
+		if !f.retryable() || cancelled(ctx, err) {
+			return
+		}
+
+		if sent && !f.retryableAfterSent(method) {
+			golog.Warnf("sc2replaystats %s (%v) after the request was sent, not retrying", f, err)
+			return
+		}
+
+		wait, ok := client.retry.wait(retry, resp)
+		if !ok {
+			return
+		}
+
+		golog.Warnf("sc2replaystats %s (%v), retrying in %v", f, err, wait.Round(time.Millisecond))
+
+		if serr := sleep(ctx, wait); serr != nil {
+			return
+		}
+	}
+}
+
+// attempt sends a request once, reading the whole response, and returns
+// whether the request body (if any) was sent whole
+func (client *Client) attempt(ctx context.Context, timeout time.Duration, method, slug, contentType string, bodyFn func() (io.Reader, int64)) ([]byte, *http.Response, bool, error) {
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		data io.Reader
+		body *sentReader
+		size int64 = -1
+	)
+
+	if bodyFn != nil {
+		var r io.Reader
+		r, size = bodyFn()
+
+		body = &sentReader{Reader: r, size: size}
+		data = body
+	}
+
+	sent := func() bool { return body != nil && body.Sent() }
+
+	resp, err := client.doRequest(ctx, method, slug, contentType, data, size)
 	if err != nil {
-		return nil, err
+		return nil, nil, sent(), err
 	}
 	defer resp.Body.Close()
 
-	result, err = ioutil.ReadAll(resp.Body)
+	result, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return
+		return nil, resp, sent(), fmt.Errorf("failed to read response: %w", err)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("sc2replaystats API returned error: %v", resp.Status)
+		err = newAPIError(resp, result)
+	} else if dup := parseDuplicate(result); dup != nil {
+		err = dup
 	}
 
-	return
+	return result, resp, sent(), err
 }
 
-func (client *Client) requestMap(method, slug, contentType string, data io.Reader) (result map[string]string, err error) {
-	resp, err := client.doRequest(method, slug, contentType, data)
-	if err != nil {
+func (client *Client) requestMap(ctx context.Context, timeout time.Duration, method, slug, contentType string, body func() (io.Reader, int64)) (result map[string]string, err error) {
+	data, err := client.request(ctx, timeout, method, slug, contentType, body)
+	if data == nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 
 	result = make(map[string]string)
-	if err = jsoniter.NewDecoder(resp.Body).Decode(&result); err != nil {
-		return nil, fmt.Errorf("decode response: %v", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		err = fmt.Errorf("sc2replaystats API returned error: %v", resp.Status)
+	if jerr := jsoniter.Unmarshal(data, &result); jerr != nil && err == nil {
+		return nil, fmt.Errorf("decode response: %v", jerr)
 	}
 
 	return
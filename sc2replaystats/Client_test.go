@@ -0,0 +1,210 @@
+package sc2replaystats_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats/sc2replaystatstest"
+)
+
+func writeReplay(t *testing.T, name, contents string) string {
+	filename := filepath.Join(t.TempDir(), name)
+	assert.Nil(t, ioutil.WriteFile(filename, []byte(contents), 0644), "must not error")
+
+	return filename
+}
+
+// waitProcessed polls the status of a queued replay like the uploader does
+func waitProcessed(client *sc2replaystats.Client, rqid string) (rid string, polls int, err error) {
+	for ; polls < 10; polls++ {
+		if rid, err = client.GetReplayStatus(rqid); rid != "" || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+func TestClientUpload(t *testing.T) {
+	srv := sc2replaystatstest.NewServer()
+	defer srv.Close()
+
+	srv.Script("slow.SC2Replay", sc2replaystatstest.Outcome{Polls: 3})
+	client := srv.Client()
+
+	rqid, err := client.UploadReplay(writeReplay(t, "slow.SC2Replay", "first"))
+	assert.Nil(t, err, "must not error")
+	assert.NotEmpty(t, rqid, "must be queued")
+
+	rid, polls, err := waitProcessed(client, rqid)
+	assert.Nil(t, err, "must not error")
+	assert.NotEmpty(t, rid, "must be processed")
+	assert.Equal(t, 3, polls, "must be processing as long as scripted")
+
+	// the same contents under another name are a duplicate of the first
+	rqid, err = client.UploadReplay(writeReplay(t, "again.SC2Replay", "first"))
+	assert.Nil(t, err, "must not error")
+
+	_, _, err = waitProcessed(client, rqid)
+	var dup *sc2replaystats.ErrDuplicate
+	if assert.True(t, errors.As(err, &dup), "must be a duplicate: %v", err) {
+		assert.Equal(t, rid, dup.ReplayID, "must be a duplicate of the first")
+	}
+
+	uploads := srv.Uploads()
+	if assert.Len(t, uploads, 2, "must record uploads") {
+		assert.Equal(t, "slow.SC2Replay", uploads[0].Filename)
+		assert.Equal(t, len("first"), uploads[0].Size)
+		assert.Equal(t, sc2replaystats.ClientIdentifier, uploads[0].Method)
+	}
+}
+
+func TestClientScripted(t *testing.T) {
+	srv := sc2replaystatstest.NewServer()
+	defer srv.Close()
+
+	srv.Script("dup.SC2Replay", sc2replaystatstest.Outcome{DuplicateOf: "42"})
+	srv.Script("bad.SC2Replay", sc2replaystatstest.Outcome{Fail: "Unsupported game mode"})
+	srv.Script("down.SC2Replay", sc2replaystatstest.Outcome{Status: http.StatusServiceUnavailable})
+	srv.Script("late.SC2Replay", sc2replaystatstest.Outcome{Delay: time.Millisecond * 200})
+	client := srv.Client()
+
+	rqid, err := client.UploadReplay(writeReplay(t, "dup.SC2Replay", "dup"))
+	assert.Nil(t, err, "must not error")
+	_, _, err = waitProcessed(client, rqid)
+	var dup *sc2replaystats.ErrDuplicate
+	assert.True(t, errors.As(err, &dup) && dup.ReplayID == "42", "must be the scripted duplicate: %v", err)
+
+	rqid, err = client.UploadReplay(writeReplay(t, "bad.SC2Replay", "bad"))
+	assert.Nil(t, err, "must not error")
+	_, _, err = waitProcessed(client, rqid)
+	var processing *sc2replaystats.ErrProcessing
+	assert.True(t, errors.As(err, &processing), "must fail processing: %v", err)
+
+	_, err = client.UploadReplay(writeReplay(t, "down.SC2Replay", "down"))
+	var apiErr *sc2replaystats.APIError
+	assert.True(t, errors.As(err, &apiErr) && apiErr.Status == http.StatusServiceUnavailable, "must fail uploading: %v", err)
+
+	client = srv.Client(sc2replaystats.WithTimeouts(sc2replaystats.Timeouts{Upload: time.Millisecond * 50}))
+	_, err = client.UploadReplay(writeReplay(t, "late.SC2Replay", "late"))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "must time out: %v", err)
+}
+
+func TestClientRetries(t *testing.T) {
+	srv := sc2replaystatstest.NewServer()
+	defer srv.Close()
+
+	client := srv.Client(sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{
+		Attempts: 3,
+		Delay:    time.Millisecond,
+		MaxDelay: time.Second,
+	}))
+
+	srv.FailNext(2, http.StatusTooManyRequests, "0")
+
+	rqid, err := client.UploadReplay(writeReplay(t, "retried.SC2Replay", "retried"))
+	assert.Nil(t, err, "must not error")
+	assert.NotEmpty(t, rqid, "must be queued")
+	assert.Equal(t, 3, srv.Requests(), "must retry until successful")
+	assert.Len(t, srv.Uploads(), 1, "failed attempts must not reach the handler")
+
+	// the replay was sent, and may have been received despite the error
+	srv.FailNext(1, http.StatusBadGateway, "")
+
+	_, err = client.UploadReplay(writeReplay(t, "sent.SC2Replay", "sent"))
+	assert.NotNil(t, err, "must error")
+	assert.Equal(t, 4, srv.Requests(), "uploads sent whole must not be retried")
+
+	// status checks may be retried all the same
+	srv.FailNext(1, http.StatusBadGateway, "")
+
+	_, err = client.GetReplayStatus(rqid)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, 6, srv.Requests(), "status checks must be retried")
+}
+
+func TestClientAccountPlayers(t *testing.T) {
+	srv := sc2replaystatstest.NewServer()
+	defer srv.Close()
+
+	srv.SetPlayers([]sc2replaystats.AccountPlayer{
+		{ID: 1, Default: 1, Player: sc2replaystats.Player{Name: "AlbinoGeek", BattleTagName: "AlbinoGeek", BattleTagID: 1234}},
+	})
+
+	players, err := srv.Client().GetAccountPlayers()
+	assert.Nil(t, err, "must not error")
+	if assert.Len(t, players, 1, "must list players") {
+		assert.Equal(t, "AlbinoGeek#1234", players[0].Player.BattleTag())
+	}
+
+	_, err = sc2replaystats.New("wrong", sc2replaystats.WithAPIRoot(srv.URL)).GetAccountPlayers()
+	assert.True(t, errors.Is(err, sc2replaystats.ErrUnauthorized), "other keys must be unauthorized: %v", err)
+}
+
+func TestClientVerifyKey(t *testing.T) {
+	srv := sc2replaystatstest.NewServer()
+	defer srv.Close()
+
+	closed := sc2replaystatstest.NewServer()
+	closed.Close()
+
+	var cases = []struct {
+		Name   string
+		Client *sc2replaystats.Client
+		Err    error
+	}{
+		{"valid", srv.Client(), nil},
+		{"unknown", sc2replaystats.New("wrong", sc2replaystats.WithAPIRoot(srv.URL)), sc2replaystats.ErrKeyInvalid},
+		{"unreachable", closed.Client(), sc2replaystats.ErrKeyUnverified},
+	}
+
+	for _, c := range cases {
+		err := c.Client.VerifyKey()
+		if c.Err == nil {
+			assert.Nil(t, err, "must not error: %v", c.Name)
+			continue
+		}
+
+		assert.True(t, errors.Is(err, c.Err), "error must match: %v: %v", c.Name, err)
+	}
+
+	srv.FailNext(1, http.StatusForbidden, "")
+	assert.True(t, errors.Is(srv.Client().VerifyKey(), sc2replaystats.ErrKeyInvalid), "forbidden keys must be invalid")
+
+	srv.FailNext(1, http.StatusInternalServerError, "")
+	assert.True(t, errors.Is(srv.Client().VerifyKey(), sc2replaystats.ErrKeyUnverified), "server errors must not condemn the key")
+}
+
+func TestClientRoots(t *testing.T) {
+	client := sc2replaystats.New("key")
+	assert.Equal(t, sc2replaystats.DefaultAPIRoot, client.APIRoot())
+	assert.Equal(t, sc2replaystats.DefaultWebRoot, client.WebRoot())
+
+	client = sc2replaystats.New("key",
+		sc2replaystats.WithAPIRoot("http://localhost:8080/api/"),
+		sc2replaystats.WithWebRoot("http://localhost:8080/"))
+	assert.Equal(t, "http://localhost:8080/api", client.APIRoot())
+	assert.Equal(t, "http://localhost:8080/replay/1234", client.ReplayURL("1234"))
+
+	// clients of different servers must not affect each other
+	first, second := sc2replaystatstest.NewServer(), sc2replaystatstest.NewServer()
+	defer first.Close()
+	defer second.Close()
+
+	_, err := first.Client().UploadReplay(writeReplay(t, "first.SC2Replay", "first"))
+	assert.Nil(t, err, "must not error")
+
+	_, err = second.Client().UploadReplay(writeReplay(t, "second.SC2Replay", "second"))
+	assert.Nil(t, err, "must not error")
+
+	assert.Len(t, first.Uploads(), 1, "must only receive its own client's uploads")
+	assert.Len(t, second.Uploads(), 1, "must only receive its own client's uploads")
+}
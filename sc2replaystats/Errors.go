@@ -0,0 +1,139 @@
+package sc2replaystats
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ErrUnauthorized means sc2replaystats did not accept the API key, the
+// *APIError returned wraps it and can be checked with errors.Is
+var ErrUnauthorized = errors.New("sc2replaystats did not accept the API key")
+
+// ErrDuplicate means the replay had already been uploaded before
+type ErrDuplicate struct {
+	// ReplayID is that of the replay uploaded before
+	ReplayID string
+}
+
+func (e *ErrDuplicate) Error() string {
+	return fmt.Sprintf("duplicate replay, already uploaded as #%s", e.ReplayID)
+}
+
+// parseDuplicate returns the *ErrDuplicate given as the "error" of a JSON
+// response, such as {"error":"Duplicate Replay: 1234"}, or nil if there is
+// none; sc2replaystats answers these with 200 OK
+func parseDuplicate(body []byte) *ErrDuplicate {
+	var res struct {
+		Error string `json:"error"`
+	}
+
+	if jsoniter.Unmarshal(body, &res) != nil || !strings.HasPrefix(res.Error, "Duplicate Replay") {
+		return nil
+	}
+
+	parts := strings.Split(res.Error, ": ")
+	if len(parts) != 2 {
+		return nil
+	}
+
+	return &ErrDuplicate{ReplayID: parts[1]}
+}
+
+// ErrProcessing means sc2replaystats accepted the replay, but then failed to
+// process it, such as when the replay is corrupt or the game mode unsupported
+type ErrProcessing struct {
+	// Reason is the explanation given by sc2replaystats
+	Reason string
+}
+
+func (e *ErrProcessing) Error() string {
+	return fmt.Sprintf("sc2replaystats failed to process replay: %s", e.Reason)
+}
+
+// ErrRateLimited means too many requests were sent, the *APIError returned
+// wraps it and can be checked with errors.As
+type ErrRateLimited struct {
+	// RetryAfter is how long sc2replaystats asked us to wait, if it did
+	RetryAfter time.Duration
+}
+
+func (e *ErrRateLimited) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("rate limited by sc2replaystats, retry after %v", e.RetryAfter)
+	}
+
+	return "rate limited by sc2replaystats"
+}
+
+// APIError means sc2replaystats answered a request with an error status
+type APIError struct {
+	// Status is the HTTP status code, such as 500
+	Status int
+
+	// Body is the response, which usually explains the error
+	Body string
+
+	// Err is ErrUnauthorized or *ErrRateLimited if applicable, or nil
+	Err error
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("sc2replaystats API returned error: %d %s", e.Status, http.StatusText(e.Status))
+
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+
+	if reason := e.Reason(); reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, reason)
+	}
+
+	return msg
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Reason returns the "error" given in a JSON Body, or the start of any other
+// Body, explaining the error
+func (e *APIError) Reason() string {
+	var res struct {
+		Error string `json:"error"`
+	}
+
+	if jsoniter.UnmarshalFromString(e.Body, &res) == nil && res.Error != "" {
+		return res.Error
+	}
+
+	reason := strings.TrimSpace(e.Body)
+	if strings.HasPrefix(reason, "<") {
+		return "" // don't bother showing HTML error pages
+	}
+
+	if len(reason) > 120 {
+		reason = reason[:120] + "..."
+	}
+
+	return reason
+}
+
+// newAPIError returns the typed error describing an error response
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	e := &APIError{Status: resp.StatusCode, Body: string(body)}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		e.Err = ErrUnauthorized
+	case http.StatusTooManyRequests:
+		after, _ := retryAfter(resp.Header.Get("Retry-After"), time.Now())
+		e.Err = &ErrRateLimited{RetryAfter: after}
+	}
+
+	return e
+}
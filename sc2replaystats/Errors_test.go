@@ -0,0 +1,77 @@
+package sc2replaystats_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+func TestErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.TrimPrefix(r.URL.Path, "/replay/status/") {
+		case "duplicate":
+			fmt.Fprint(w, `{"error":"Duplicate Replay: 1234"}`)
+		case "corrupt":
+			fmt.Fprint(w, `{"error":"Replay file is corrupt"}`)
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"Invalid API key"}`)
+		case "limited":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "broken":
+			w.WriteHeader(http.StatusBadGateway)
+			fmt.Fprint(w, "<html>Bad Gateway</html>")
+		default:
+			fmt.Fprint(w, `{"replay_id":"1"}`)
+		}
+	}))
+	defer srv.Close()
+
+	client := sc2replaystats.New("key", sc2replaystats.WithAPIRoot(srv.URL), sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{Attempts: 1}))
+
+	_, err := client.GetReplayStatus("duplicate")
+	var dup *sc2replaystats.ErrDuplicate
+	if assert.True(t, errors.As(err, &dup), "must be a duplicate: %v", err) {
+		assert.Equal(t, "1234", dup.ReplayID, "must have the original replay ID")
+	}
+
+	_, err = client.GetReplayStatus("corrupt")
+	var processing *sc2replaystats.ErrProcessing
+	if assert.True(t, errors.As(err, &processing), "must be a processing error: %v", err) {
+		assert.Equal(t, "Replay file is corrupt", processing.Reason, "must have the reason")
+	}
+
+	_, err = client.GetReplayStatus("unauthorized")
+	var apiErr *sc2replaystats.APIError
+	assert.True(t, errors.Is(err, sc2replaystats.ErrUnauthorized), "must be unauthorized: %v", err)
+	if assert.True(t, errors.As(err, &apiErr), "must be an API error: %v", err) {
+		assert.Equal(t, http.StatusUnauthorized, apiErr.Status, "must have the status")
+		assert.Equal(t, "Invalid API key", apiErr.Reason(), "must have the reason")
+	}
+
+	_, err = client.GetReplayStatus("limited")
+	var limited *sc2replaystats.ErrRateLimited
+	if assert.True(t, errors.As(err, &limited), "must be rate limited: %v", err) {
+		assert.Equal(t, 2*time.Minute, limited.RetryAfter, "must have the delay asked for")
+	}
+
+	_, err = client.GetReplayStatus("broken")
+	if assert.True(t, errors.As(err, &apiErr), "must be an API error: %v", err) {
+		assert.Equal(t, http.StatusBadGateway, apiErr.Status, "must have the status")
+		assert.Equal(t, "", apiErr.Reason(), "must not show HTML as the reason")
+		assert.Nil(t, apiErr.Err, "must not be a more specific error")
+	}
+
+	rid, err := client.GetReplayStatus("ok")
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, "1", rid, "must have the replay ID")
+}
@@ -1,6 +1,7 @@
 package sc2replaystats
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -10,10 +11,15 @@ import (
 // GetAccountPlayers returns an slice of AccountPlayers from the server,
 // showing all those Accounts/Toons associated with the given API key
 func (client *Client) GetAccountPlayers() (players []AccountPlayer, err error) {
-	result, err := client.requestBytes(http.MethodGet, "account/players", "", nil)
+	return client.GetAccountPlayersContext(context.Background())
+}
+
+// GetAccountPlayersContext is GetAccountPlayers, giving up once ctx is done
+func (client *Client) GetAccountPlayersContext(ctx context.Context) (players []AccountPlayer, err error) {
+	result, err := client.request(ctx, client.timeouts.Account, http.MethodGet, "account/players", "", nil)
 
 	if err != nil {
-		return nil, fmt.Errorf("GetAccountPlayers: %v", err)
+		return nil, fmt.Errorf("GetAccountPlayers: %w", err)
 	}
 
 	players = make([]AccountPlayer, 0)
@@ -1,20 +1,25 @@
 package sc2replaystats
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"strings"
-
-	"github.com/kataras/golog"
 )
 
 // GetReplayStatus tries to retrieve the replayID associated with a given
-// replayQueueID -- returning an empty string if it's still processing
+// replayQueueID -- returning an empty string if it's still processing; the
+// error is an *ErrDuplicate if the replay had been uploaded before, or an
+// *ErrProcessing if sc2replaystats could not process it
 func (client *Client) GetReplayStatus(replayQueueID string) (replayID string, err error) {
-	res, err := client.requestMap(http.MethodGet, fmt.Sprintf("replay/status/%s", replayQueueID), "", nil)
+	return client.GetReplayStatusContext(context.Background(), replayQueueID)
+}
+
+// GetReplayStatusContext is GetReplayStatus, giving up once ctx is done
+func (client *Client) GetReplayStatusContext(ctx context.Context, replayQueueID string) (replayID string, err error) {
+	res, err := client.requestMap(ctx, client.timeouts.Status, http.MethodGet, fmt.Sprintf("replay/status/%s", replayQueueID), "", nil)
 
 	if err != nil {
-		return "", fmt.Errorf("GetReplayStatus: %v", err)
+		return "", fmt.Errorf("GetReplayStatus: %w", err)
 	}
 
 	// return the replay_id if present
@@ -22,18 +27,9 @@ func (client *Client) GetReplayStatus(replayQueueID string) (replayID string, er
 		replayID = rid
 	}
 
+	// duplicates are an error of the request already
 	if e, ok := res["error"]; ok {
-		if strings.HasPrefix(e, "Duplicate Replay") {
-			parts := strings.Split(e, ": ")
-			if len(parts) == 2 {
-				replayID = parts[1]
-				return
-			}
-		}
-
-		golog.Debugf("sc2replaystats failure: %v", e)
-
-		err = fmt.Errorf("replay processing failed")
+		return "", &ErrProcessing{Reason: e}
 	}
 
 	return
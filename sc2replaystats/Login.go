@@ -0,0 +1,242 @@
+package sc2replaystats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrUnexpectedPage means a page of the Website did not look as expected,
+// such as after the Website was redesigned; logging in with a browser may
+// still work
+var ErrUnexpectedPage = errors.New("unexpected page from sc2replaystats")
+
+// LoginError means the Website refused to sign in, such as when the email
+// address or password was wrong
+type LoginError struct {
+	// Reason is the explanation given by the Website, if any
+	Reason string
+}
+
+func (e *LoginError) Error() string {
+	if e.Reason == "" {
+		return "sc2replaystats login failed"
+	}
+
+	return fmt.Sprintf("sc2replaystats login failed: %s", e.Reason)
+}
+
+// Session is signed in to the sc2replaystats Website, as a user would be in
+// their browser, see Login
+type Session struct {
+	// AccountID is the sc2replaystats account signed in to
+	AccountID string
+
+	client  *http.Client
+	timeout Timeouts
+	webRoot string
+}
+
+// Login signs in to the sc2replaystats Website with the email address and
+// password of an account, using the Website root, http.Client (of which a
+// copy keeping cookies is used) and Account timeout of the options given
+func Login(ctx context.Context, email, password string, opts ...Option) (*Session, error) {
+	c := New("", opts...)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := *c.client
+	client.Jar = jar
+
+	s := &Session{
+		client:  &client,
+		timeout: c.timeouts,
+		webRoot: c.webRoot,
+	}
+
+	doc, page, err := s.get(ctx, "Account/signin")
+	if err != nil {
+		return nil, err
+	}
+
+	form := find(doc, func(n *html.Node) bool {
+		return n.Data == "form" && find(n, func(i *html.Node) bool { return i.Data == "input" && attr(i, "name") == "password" }) != nil
+	})
+
+	if form == nil {
+		return nil, fmt.Errorf("%w: no login form on %v", ErrUnexpectedPage, page)
+	}
+
+	f := parseForm(form, page)
+	f.values.Set("email", email)
+	f.values.Set("password", password)
+
+	if doc, page, err = s.submit(ctx, f); err != nil {
+		return nil, err
+	}
+
+	// signing in redirects to the account's page, "/display/..../<AccountID>"
+	if parts := strings.Split(page.Path, "/"); strings.Contains(page.Path, "display") && parts[len(parts)-1] != "" {
+		s.AccountID = parts[len(parts)-1]
+		return s, nil
+	}
+
+	if alert := find(doc, func(n *html.Node) bool { return hasClass(n, "alert-danger") }); alert != nil {
+		// without the "×" of the alert's close button
+		return nil, &LoginError{Reason: strings.TrimSpace(strings.TrimPrefix(text(alert), "×"))}
+	}
+
+	if strings.EqualFold(path.Base(page.Path), "signin") {
+		return nil, &LoginError{}
+	}
+
+	return nil, fmt.Errorf("%w: unexpected redirect after login: %v", ErrUnexpectedPage, page)
+}
+
+// APIKey returns the API key of the account, found on its settings page,
+// generating one first if the account has none
+func (s *Session) APIKey(ctx context.Context) (string, error) {
+	slug := fmt.Sprintf("account/settings/%s", s.AccountID)
+
+	doc, page, err := s.get(ctx, slug)
+	if err != nil {
+		return "", err
+	}
+
+	if key, shown := findAPIKey(doc); key != "" {
+		return key, nil
+	} else if shown {
+		// generating a new key would revoke the one shown, which may be
+		// in use elsewhere, so it is left to the user in their browser
+		return "", fmt.Errorf("%w: cannot read the API key on %v", ErrUnexpectedPage, page)
+	}
+
+	gen := find(doc, func(n *html.Node) bool {
+		return (n.Data == "a" || n.Data == "button" || n.Data == "input") &&
+			(strings.Contains(text(n), "Generate New API Key") || attr(n, "value") == "Generate New API Key")
+	})
+
+	switch {
+	case gen == nil:
+		return "", fmt.Errorf("%w: no API key on %v", ErrUnexpectedPage, page)
+	case closest(gen, "form") != nil:
+		_, _, err = s.submit(ctx, parseForm(closest(gen, "form"), page))
+	case attr(gen, "href") != "" && !strings.HasPrefix(attr(gen, "href"), "#"):
+		var u *url.URL
+		if u, err = page.Parse(attr(gen, "href")); err == nil {
+			_, _, err = s.do(ctx, http.MethodGet, u, nil)
+		}
+	default:
+		return "", fmt.Errorf("%w: cannot generate API key on %v", ErrUnexpectedPage, page)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if doc, page, err = s.get(ctx, slug); err != nil {
+		return "", err
+	}
+
+	if key, _ := findAPIKey(doc); key != "" {
+		return key, nil
+	}
+
+	return "", fmt.Errorf("%w: no API key on %v after generating one", ErrUnexpectedPage, page)
+}
+
+// findAPIKey returns the API key shown as "Authorization Key" on a settings
+// page, either as text or as the value of an input, or an empty string, and
+// whether the page shows an "Authorization Key" at all
+func findAPIKey(doc *html.Node) (key string, shown bool) {
+	for _, group := range findAll(doc, func(n *html.Node) bool { return hasClass(n, "form-group") }) {
+		t := text(group)
+
+		i := strings.Index(t, "Authorization Key")
+		if i < 0 {
+			continue
+		}
+
+		shown = true
+
+		for _, input := range findAll(group, func(n *html.Node) bool { return n.Data == "input" }) {
+			if key := strings.TrimSpace(attr(input, "value")); ValidAPIKey(key) {
+				return key, true
+			}
+		}
+
+		if fields := strings.Fields(strings.TrimLeft(t[i+len("Authorization Key"):], ": ")); len(fields) > 0 && ValidAPIKey(fields[0]) {
+			return fields[0], true
+		}
+	}
+
+	return "", shown
+}
+
+func (s *Session) get(ctx context.Context, slug string) (*html.Node, *url.URL, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/%s", s.webRoot, slug))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return s.do(ctx, http.MethodGet, u, nil)
+}
+
+func (s *Session) submit(ctx context.Context, f *htmlForm) (*html.Node, *url.URL, error) {
+	if f.method == http.MethodGet {
+		u := *f.action
+		u.RawQuery = f.values.Encode()
+
+		return s.do(ctx, http.MethodGet, &u, nil)
+	}
+
+	return s.do(ctx, f.method, f.action, strings.NewReader(f.values.Encode()))
+}
+
+// do requests a page, following redirects, and returns it parsed along with
+// the address it was finally found at
+func (s *Session) do(ctx context.Context, method string, u *url.URL, body io.Reader) (*html.Node, *url.URL, error) {
+	ctx, cancel := withTimeout(ctx, s.timeout.Account)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to prepare request: %v", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil, fmt.Errorf("%w: %v not found", ErrUnexpectedPage, resp.Request.URL)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, newAPIError(resp, nil)
+	}
+
+	doc, err := html.Parse(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read page: %w", err)
+	}
+
+	return doc, resp.Request.URL, nil
+}
@@ -0,0 +1,166 @@
+package sc2replaystats_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+const (
+	testKey   = "0123456789012345678901234567890123456789;0123456789012345678901234567890123456789;1609459200"
+	testToken = "c2MycnN1LXRlc3QtdG9rZW4"
+)
+
+// website is a fake sc2replaystats Website serving the pages recorded in
+// testdata/login, where "john@doe.com" signs in with "hunter2" as #9001
+type website struct {
+	*httptest.Server
+
+	mu  sync.Mutex
+	key string
+}
+
+func newWebsite(t *testing.T, key string) *website {
+	page := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", "login", name))
+		assert.Nil(t, err, "must not error")
+
+		return string(data)
+	}
+
+	site := &website{key: key}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/Account/signin", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "guest", Path: "/"})
+
+			if r.URL.Query().Get("failed") != "" {
+				w.Write([]byte(page("signin-failed.html")))
+			} else {
+				w.Write([]byte(page("signin.html")))
+			}
+
+			return
+		}
+
+		c, err := r.Cookie("session")
+		if err != nil || r.PostFormValue("_token") != testToken || c.Value != "guest" {
+			http.Error(w, "Page Expired", 419)
+			return
+		}
+
+		if r.PostFormValue("email") != "john@doe.com" || r.PostFormValue("password") != "hunter2" {
+			http.Redirect(w, r, "/Account/signin?failed=1", http.StatusFound)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "9001", Path: "/"})
+		http.Redirect(w, r, "/display/account/9001", http.StatusFound)
+	})
+
+	signedIn := func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if c, err := r.Cookie("session"); err != nil || c.Value != "9001" {
+				http.Redirect(w, r, "/Account/signin", http.StatusFound)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+
+	mux.HandleFunc("/display/account/9001", signedIn(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page("display.html")))
+	}))
+
+	mux.HandleFunc("/account/settings/9001", signedIn(func(w http.ResponseWriter, r *http.Request) {
+		site.mu.Lock()
+		defer site.mu.Unlock()
+
+		if site.key == "" {
+			w.Write([]byte(page("settings-nokey.html")))
+		} else {
+			w.Write([]byte(strings.Replace(page("settings.html"), "{{KEY}}", site.key, 1)))
+		}
+	}))
+
+	mux.HandleFunc("/account/settings/9001/api", signedIn(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.PostFormValue("_token") != testToken {
+			http.Error(w, "Page Expired", 419)
+			return
+		}
+
+		site.mu.Lock()
+		site.key = testKey
+		site.mu.Unlock()
+
+		http.Redirect(w, r, "/account/settings/9001", http.StatusFound)
+	}))
+
+	site.Server = httptest.NewServer(mux)
+
+	return site
+}
+
+func TestLogin(t *testing.T) {
+	for _, existing := range []string{testKey, ""} {
+		site := newWebsite(t, existing)
+
+		s, err := sc2replaystats.Login(context.Background(), "john@doe.com", "hunter2", sc2replaystats.WithWebRoot(site.URL))
+		if assert.Nil(t, err, "must not error") {
+			assert.Equal(t, "9001", s.AccountID, "must find account ID")
+
+			key, err := s.APIKey(context.Background())
+			assert.Nil(t, err, "must not error")
+			assert.Equal(t, testKey, key, "must find or generate API key")
+		}
+
+		site.Close()
+	}
+}
+
+func TestLoginErrors(t *testing.T) {
+	site := newWebsite(t, testKey)
+	defer site.Close()
+
+	_, err := sc2replaystats.Login(context.Background(), "john@doe.com", "wrong", sc2replaystats.WithWebRoot(site.URL))
+
+	var loginErr *sc2replaystats.LoginError
+	if assert.True(t, errors.As(err, &loginErr), "wrong passwords must fail login: %v", err) {
+		assert.Equal(t, "These credentials do not match our records.", loginErr.Reason, "must give the Website's reason")
+	}
+
+	// a redesigned Website, where the sign in page moved
+	_, err = sc2replaystats.Login(context.Background(), "john@doe.com", "hunter2", sc2replaystats.WithWebRoot(site.URL+"/moved"))
+	assert.True(t, errors.Is(err, sc2replaystats.ErrUnexpectedPage), "missing pages must be reported: %v", err)
+
+	// or has no sign in form anymore
+	redesigned := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><body><div id=\"app\"></div><script src=\"/app.js\"></script></body></html>"))
+	}))
+	defer redesigned.Close()
+
+	_, err = sc2replaystats.Login(context.Background(), "john@doe.com", "hunter2", sc2replaystats.WithWebRoot(redesigned.URL))
+	assert.True(t, errors.Is(err, sc2replaystats.ErrUnexpectedPage), "unknown pages must be reported: %v", err)
+
+	// a key shown in a format we do not know must not be replaced
+	site.key = "0123456789abcdef"
+
+	s, err := sc2replaystats.Login(context.Background(), "john@doe.com", "hunter2", sc2replaystats.WithWebRoot(site.URL))
+	if assert.Nil(t, err, "must not error") {
+		_, err = s.APIKey(context.Background())
+		assert.True(t, errors.Is(err, sc2replaystats.ErrUnexpectedPage), "unreadable keys must be reported: %v", err)
+		assert.Equal(t, "0123456789abcdef", site.key, "must not generate a new key")
+	}
+}
@@ -0,0 +1,218 @@
+package sc2replaystats
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRetryPolicy is used by clients not given any WithRetryPolicy option
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 4,
+	Delay:    time.Second * 2,
+	MaxDelay: time.Minute,
+}
+
+// RetryPolicy decides how often and when failed requests are sent again;
+// only network errors, server errors (5xx) and rate limiting (429) are
+// retried, as anything else (such as a bad API key) would fail again, and
+// uploads are only retried when rate limited once the replay was sent whole,
+// as sc2replaystats may have received it even if the answer was lost
+type RetryPolicy struct {
+	// Attempts is how many times a request is sent at most, 1 disables retries
+	Attempts int
+
+	// Delay is roughly how long to wait before the first retry, doubling with
+	// each retry after and randomized so that clients do not retry in step
+	Delay time.Duration
+
+	// MaxDelay limits how long to wait before any retry; a server asking us
+	// (via Retry-After) to wait longer than this is not retried at all
+	MaxDelay time.Duration
+}
+
+// WithRetryPolicy sets how failed requests are retried
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(client *Client) {
+		client.retry = policy
+	}
+}
+
+// failure classifies why a request failed, deciding whether it is retried
+type failure uint8
+
+const (
+	failureNone failure = iota
+	failureNetwork
+	failureServer
+	failureRateLimited
+	failureUnauthorized
+	failureRejected
+	failureDuplicate
+)
+
+var failureNames = map[failure]string{
+	failureNone:         "success",
+	failureNetwork:      "network error",
+	failureServer:       "server error",
+	failureRateLimited:  "rate limited",
+	failureUnauthorized: "unauthorized",
+	failureRejected:     "rejected",
+	failureDuplicate:    "duplicate",
+}
+
+func (f failure) String() string {
+	return failureNames[f]
+}
+
+// retryable returns whether sending the request again may succeed
+func (f failure) retryable() bool {
+	return f == failureNetwork || f == failureServer || f == failureRateLimited
+}
+
+// retryableAfterSent returns whether sending a request again may succeed,
+// and does no harm, once its body was sent whole; only rate limiting (where
+// the request is refused outright) is, unless the method is idempotent
+func (f failure) retryableAfterSent(method string) bool {
+	if method != http.MethodPost {
+		return f.retryable()
+	}
+
+	return f == failureRateLimited
+}
+
+// classify returns why an attempt failed, given its response (if any)
+func classify(resp *http.Response, err error) failure {
+	var dup *ErrDuplicate
+
+	switch {
+	case resp == nil && err == nil:
+		return failureNone
+	case errors.As(err, &dup):
+		return failureDuplicate
+	case resp == nil, resp.StatusCode == http.StatusOK && err != nil:
+		// the connection failed, or broke while reading the response
+		return failureNetwork
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return failureRateLimited
+	case resp.StatusCode == http.StatusUnauthorized, resp.StatusCode == http.StatusForbidden:
+		return failureUnauthorized
+	case resp.StatusCode >= 500:
+		return failureServer
+	case resp.StatusCode != http.StatusOK:
+		return failureRejected
+	}
+
+	return failureNone
+}
+
+// wait returns how long to wait before the given retry (starting at 1), and
+// false if the request should not be retried (again)
+func (policy RetryPolicy) wait(retry int, resp *http.Response) (time.Duration, bool) {
+	if retry >= policy.Attempts {
+		return 0, false
+	}
+
+	if resp != nil {
+		if after, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return after, after <= policy.MaxDelay
+		}
+	}
+
+	delay := policy.Delay
+	for i := 1; i < retry && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	// wait anywhere between half and all of the delay
+	if half := int64(delay / 2); half > 0 {
+		delay = time.Duration(half + rand.Int63n(half+1))
+	}
+
+	return delay, true
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date, into how long to wait from now
+func retryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// sentReader reads a request body, recording once it was read whole by the
+// transport sending it, after which the server may act on the request
+type sentReader struct {
+	io.Reader
+	read int64
+	sent int32
+	size int64
+}
+
+func (r *sentReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+
+	r.read += int64(n)
+	if err == io.EOF || (r.size >= 0 && r.read >= r.size) {
+		atomic.StoreInt32(&r.sent, 1)
+	}
+
+	return n, err
+}
+
+// Close closes the body read, if it can be closed
+func (r *sentReader) Close() error {
+	if c, ok := r.Reader.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// Sent returns whether the body was read whole
+func (r *sentReader) Sent() bool {
+	return atomic.LoadInt32(&r.sent) == 1
+}
+
+// sleep waits for the duration given, returning early with an error if ctx
+// is cancelled first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// cancelled returns whether err is due to the caller's context, rather than
+// a timeout of a single attempt
+func cancelled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,87 @@
+package sc2replaystats_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+func TestRetry(t *testing.T) {
+	var cases = []struct {
+		Name     string
+		Statuses []int
+		Header   string
+		Attempts int32
+		Success  bool
+	}{
+		{"ok", []int{200}, "", 1, true},
+		{"server errors", []int{503, 500, 200}, "", 3, true},
+		{"rate limited", []int{429, 200}, "0", 2, true},
+		{"rate limited too long", []int{429, 200}, "3600", 1, false},
+		{"unauthorized", []int{401, 200}, "", 1, false},
+		{"not found", []int{404, 200}, "", 1, false},
+		{"gives up", []int{502, 502, 502, 502, 200}, "", 3, false},
+		{"duplicate", []int{200, 200}, "", 1, false},
+	}
+
+	for _, c := range cases {
+		var attempts int32
+
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&attempts, 1)
+			if c.Header != "" {
+				w.Header().Set("Retry-After", c.Header)
+			}
+
+			w.WriteHeader(c.Statuses[n-1])
+
+			if c.Name == "duplicate" {
+				fmt.Fprint(w, `{"error":"Duplicate Replay: 1"}`)
+			} else {
+				fmt.Fprint(w, `{"replay_id":"1"}`)
+			}
+		}))
+
+		client := sc2replaystats.New("key", sc2replaystats.WithAPIRoot(srv.URL), sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{
+			Attempts: 3,
+			Delay:    time.Millisecond,
+			MaxDelay: time.Second,
+		}))
+
+		rid, err := client.GetReplayStatus("1")
+		assert.Equal(t, c.Success, err == nil, "success must match: %v: %v", c.Name, err)
+		assert.Equal(t, c.Success, rid == "1", "replay ID must match: %v", c.Name)
+		assert.Equal(t, c.Attempts, atomic.LoadInt32(&attempts), "attempts must match: %v", c.Name)
+
+		srv.Close()
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	client := sc2replaystats.New("key", sc2replaystats.WithAPIRoot(srv.URL), sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{
+		Attempts: 10,
+		Delay:    time.Hour,
+		MaxDelay: time.Hour,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.GetReplayStatusContext(ctx, "1")
+	assert.NotNil(t, err, "must error")
+	assert.Less(t, int64(time.Since(start)), int64(time.Second), "must not keep waiting once cancelled")
+}
@@ -1,54 +1,160 @@
 package sc2replaystats
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"mime/multipart"
 	"net/http"
 	"os"
 )
 
-func prepareMultipartUpload(filename string) (buf bytes.Buffer, contentType string, err error) {
-	mpw := multipart.NewWriter(&buf)
-	defer mpw.Close()
+// ProgressFunc is called as a replay is being sent, with how many of its
+// total bytes were sent so far; it starts over when the upload is retried
+type ProgressFunc func(sent, total int64)
 
-	w, err := mpw.CreateFormFile("replay_file", filename)
+// multipartUpload streams a replay as multipart form data, reading it from
+// disk as it is being sent instead of holding the whole replay in memory
+type multipartUpload struct {
+	filename string
+	boundary string
+	size     int64
+	progress ProgressFunc
+}
+
+func newMultipartUpload(filename string, progress ProgressFunc) (*multipartUpload, error) {
+	info, err := os.Stat(filename)
 	if err != nil {
-		return buf, "", fmt.Errorf("create form file: %v", err)
+		return nil, fmt.Errorf("open form file: %v", err)
+	}
+
+	u := &multipartUpload{
+		filename: filename,
+		boundary: multipart.NewWriter(ioutil.Discard).Boundary(),
+		progress: progress,
+	}
+
+	// the form is the same with or without the replay in it, so its size is
+	// known beforehand and sent as Content-Length rather than chunked
+	counter := &countingWriter{}
+	if err = u.write(counter, nil); err != nil {
+		return nil, err
 	}
 
-	f, err := os.Open(filename)
+	u.size = counter.n + info.Size()
+
+	return u, nil
+}
+
+// ContentType returns the Content-Type of the form, including its boundary
+func (u *multipartUpload) ContentType() string {
+	return "multipart/form-data; boundary=" + u.boundary
+}
+
+// Body returns a new reader of the whole form, and its size
+func (u *multipartUpload) Body() (io.Reader, int64) {
+	pr, pw := io.Pipe()
+
+	go func() {
+		f, err := os.Open(u.filename)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("open form file: %v", err))
+			return
+		}
+		defer f.Close()
+
+		pw.CloseWithError(u.write(pw, f))
+	}()
+
+	return &progressReader{ReadCloser: pr, total: u.size, progress: u.progress}, u.size
+}
+
+// write writes the form to w, with the contents of replay (if not nil)
+func (u *multipartUpload) write(w io.Writer, replay io.Reader) error {
+	mpw := multipart.NewWriter(w)
+	if err := mpw.SetBoundary(u.boundary); err != nil {
+		return err
+	}
+
+	fw, err := mpw.CreateFormFile("replay_file", u.filename)
 	if err != nil {
-		return buf, "", fmt.Errorf("open form file: %v", err)
+		return fmt.Errorf("create form file: %v", err)
 	}
-	defer f.Close()
 
-	if _, err = io.Copy(w, f); err != nil {
-		return
+	if replay != nil {
+		if _, err = io.Copy(fw, replay); err != nil {
+			return err
+		}
 	}
 
 	if err = mpw.WriteField("upload_method", ClientIdentifier); err != nil {
-		return
+		return err
 	}
 
-	return buf, mpw.FormDataContentType(), nil
+	return mpw.Close()
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// progressReader reports how much of a request body was read (sent) so far
+type progressReader struct {
+	io.ReadCloser
+	sent     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+
+	if n > 0 && r.progress != nil {
+		r.sent += int64(n)
+		r.progress(r.sent, r.total)
+	}
+
+	return n, err
 }
 
 // UploadReplay sends the specified replay to sc2replaystats queue for processing
 func (client *Client) UploadReplay(filename string) (replayQueueID string, err error) {
-	buf, contentType, err := prepareMultipartUpload(filename)
+	return client.UploadReplayContext(context.Background(), filename)
+}
 
+// UploadReplayContext is UploadReplay, giving up once ctx is done
+func (client *Client) UploadReplayContext(ctx context.Context, filename string) (replayQueueID string, err error) {
+	return client.UploadReplayProgress(ctx, filename, nil)
+}
+
+// UploadReplayProgress is UploadReplayContext, calling progress (if not nil)
+// as the replay is being sent
+func (client *Client) UploadReplayProgress(ctx context.Context, filename string, progress ProgressFunc) (replayQueueID string, err error) {
+	upload, err := newMultipartUpload(filename, progress)
 	if err != nil {
 		return "", fmt.Errorf("failed to prepare formdata: %v", err)
 	}
 
-	res, err := client.requestMap(http.MethodPost, "replay", contentType, &buf)
+	res, err := client.requestMap(ctx, client.timeouts.Upload, http.MethodPost, "replay", upload.ContentType(), upload.Body)
+
+	if err != nil {
+		return "", err
+	}
 
 	// return the replay_queue_id if present
-	if rqid, ok := res["replay_queue_id"]; ok {
-		replayQueueID = rqid
+	if rqid, ok := res["replay_queue_id"]; ok && rqid != "" {
+		return rqid, nil
+	}
+
+	if e, ok := res["error"]; ok {
+		return "", &ErrProcessing{Reason: e}
 	}
 
-	return
+	return "", fmt.Errorf("sc2replaystats did not queue the replay")
 }
@@ -0,0 +1,84 @@
+package sc2replaystats_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+func TestUploadReplayStreams(t *testing.T) {
+	const size = 64 << 20
+
+	var received int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mr, err := r.MultipartReader()
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+
+			if part.FormName() == "replay_file" {
+				received, _ = io.Copy(ioutil.Discard, part)
+			}
+		}
+
+		if r.ContentLength <= size {
+			w.WriteHeader(http.StatusLengthRequired)
+			return
+		}
+
+		fmt.Fprint(w, `{"replay_queue_id":"1"}`)
+	}))
+	defer srv.Close()
+
+	// a sparse file takes no space on disk, but reads as size zeroes
+	filename := filepath.Join(t.TempDir(), "large.SC2Replay")
+	f, err := os.Create(filename)
+	assert.Nil(t, err, "must not error")
+	assert.Nil(t, f.Truncate(size), "must not error")
+	assert.Nil(t, f.Close(), "must not error")
+
+	var sent, total, calls int64
+	progress := func(s, t int64) {
+		sent, total = s, t
+		calls++
+	}
+
+	client := sc2replaystats.New("key", sc2replaystats.WithAPIRoot(srv.URL))
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	rqid, err := client.UploadReplayProgress(context.Background(), filename, progress)
+
+	runtime.ReadMemStats(&after)
+
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, "1", rqid, "must be queued")
+	assert.Equal(t, int64(size), received, "must send the whole replay")
+	assert.Equal(t, total, sent, "progress must reach the total")
+	assert.Greater(t, total, int64(size), "total must include the form around the replay")
+	assert.Greater(t, calls, int64(1), "progress must be reported along the way")
+
+	// buffering the replay would allocate at least its whole size
+	allocated := after.TotalAlloc - before.TotalAlloc
+	assert.Less(t, allocated, uint64(size/4), "memory must stay flat, allocated %d bytes", allocated)
+}
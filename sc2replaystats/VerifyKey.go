@@ -0,0 +1,44 @@
+package sc2replaystats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrKeyInvalid means sc2replaystats does not accept the API key, be it
+	// mistyped, expired, or revoked by generating a new one.
+	//
+	// There is no separate error for expired or revoked keys, as the API
+	// gives no way to tell them apart from invalid keys: all are refused
+	// alike (401 or 403), with no documented reason.
+	ErrKeyInvalid = errors.New("sc2replaystats does not accept this API key")
+
+	// ErrKeyUnverified means the API key could not be checked, such as when
+	// sc2replaystats could not be reached; it may well be valid
+	ErrKeyUnverified = errors.New("could not verify API key with sc2replaystats")
+)
+
+// VerifyKey asks sc2replaystats whether it accepts the client's API key,
+// returning an error wrapping ErrKeyInvalid (invalid, expired or revoked, see
+// there) or ErrKeyUnverified (network and server errors) if not, which can be
+// checked with errors.Is
+func (client *Client) VerifyKey() error {
+	return client.VerifyKeyContext(context.Background())
+}
+
+// VerifyKeyContext is VerifyKey, giving up once ctx is done
+func (client *Client) VerifyKeyContext(ctx context.Context) error {
+	_, err := client.GetAccountPlayersContext(ctx)
+	if err == nil {
+		return nil
+	}
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(apiErr, ErrUnauthorized) {
+		return fmt.Errorf("%w: %v", ErrKeyUnverified, err)
+	}
+
+	return fmt.Errorf("%w: %v", ErrKeyInvalid, err)
+}
@@ -0,0 +1,159 @@
+package sc2replaystats
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// htmlForm is a form found in a page, filled in with its default values
+type htmlForm struct {
+	action *url.URL
+	method string
+	values url.Values
+}
+
+// walk calls fn for n and every node below it, depth-first, until fn
+// returns false
+func walk(n *html.Node, fn func(*html.Node) bool) bool {
+	if !fn(n) {
+		return false
+	}
+
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if !walk(c, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// find returns the first element below n (n included) matching fn, or nil
+func find(n *html.Node, fn func(*html.Node) bool) (found *html.Node) {
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && fn(c) {
+			found = c
+		}
+
+		return found == nil
+	})
+
+	return
+}
+
+// findAll returns every element below n (n included) matching fn
+func findAll(n *html.Node, fn func(*html.Node) bool) (found []*html.Node) {
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.ElementNode && fn(c) {
+			found = append(found, c)
+		}
+
+		return true
+	})
+
+	return
+}
+
+// closest returns n or its nearest ancestor which is a tag element, or nil
+func closest(n *html.Node, tag string) *html.Node {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && n.Data == tag {
+			return n
+		}
+	}
+
+	return nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasClass(n *html.Node, class string) bool {
+	for _, c := range strings.Fields(attr(n, "class")) {
+		if c == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// text returns the text below n, with runs of whitespace collapsed
+func text(n *html.Node) string {
+	var b strings.Builder
+
+	walk(n, func(c *html.Node) bool {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+			b.WriteByte(' ')
+		}
+
+		return true
+	})
+
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// parseForm returns form with the values it would submit as is, resolving
+// its action relative to the page at base
+func parseForm(form *html.Node, base *url.URL) *htmlForm {
+	f := &htmlForm{
+		action: base,
+		method: strings.ToUpper(attr(form, "method")),
+		values: make(url.Values),
+	}
+
+	if f.method == "" {
+		f.method = "GET"
+	}
+
+	if action := attr(form, "action"); action != "" {
+		if u, err := base.Parse(action); err == nil {
+			f.action = u
+		}
+	}
+
+	for _, input := range findAll(form, func(n *html.Node) bool { return n.Data == "input" || n.Data == "textarea" }) {
+		name := attr(input, "name")
+
+		switch strings.ToLower(attr(input, "type")) {
+		case "submit", "button", "image", "reset", "file":
+			continue
+		case "checkbox", "radio":
+			if !hasAttr(input, "checked") {
+				continue
+			}
+		}
+
+		if name == "" {
+			continue
+		}
+
+		if input.Data == "textarea" {
+			f.values.Add(name, text(input))
+		} else {
+			f.values.Add(name, attr(input, "value"))
+		}
+	}
+
+	return f
+}
@@ -0,0 +1,315 @@
+// Package sc2replaystatstest provides a fake sc2replaystats API server for
+// testing clients of package sc2replaystats without reaching the live site.
+//
+// The server accepts uploads, processes them while their status is polled
+// and reports duplicates of replays it has seen before, all in memory. How
+// each replay (or request) fares can be scripted, see Outcome and FailNext.
+package sc2replaystatstest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+// APIKey is the only API key accepted by a Server, unless changed by SetAPIKey
+const APIKey = "sc2replaystatstest"
+
+// Outcome scripts how the Server treats an uploaded replay
+type Outcome struct {
+	// Delay is how long answering the upload request takes
+	Delay time.Duration
+
+	// Polls is how many status requests report the replay still processing
+	Polls int
+
+	// DuplicateOf makes processing report a duplicate of this replay ID
+	DuplicateOf string
+
+	// Fail makes processing fail, giving this as the reason
+	Fail string
+
+	// Status makes the upload request fail with this HTTP status code
+	Status int
+}
+
+// Upload is a replay the Server received
+type Upload struct {
+	// Filename is the name of the file uploaded, without its directory
+	Filename string
+
+	// Size is the size of the file uploaded
+	Size int
+
+	// Method is the "upload_method" identifying the client
+	Method string
+
+	// QueueID is the replay queue ID returned, or empty if the upload failed
+	QueueID string
+}
+
+type failure struct {
+	status     int
+	retryAfter string
+}
+
+type queued struct {
+	outcome  Outcome
+	hash     [sha256.Size]byte
+	polls    int
+	replayID string
+}
+
+// Server is a fake sc2replaystats API, which must be closed after use
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	apikey   string
+	failures []failure
+	hashes   map[[sha256.Size]byte]string
+	nextID   int
+	outcomes map[string]Outcome
+	players  []sc2replaystats.AccountPlayer
+	queue    map[string]*queued
+	requests int
+	uploads  []Upload
+}
+
+// NewServer starts and returns a new Server
+func NewServer() *Server {
+	s := &Server{
+		apikey:   APIKey,
+		failures: make([]failure, 0),
+		hashes:   make(map[[sha256.Size]byte]string),
+		nextID:   1000,
+		outcomes: make(map[string]Outcome),
+		players:  make([]sc2replaystats.AccountPlayer, 0),
+		queue:    make(map[string]*queued),
+		uploads:  make([]Upload, 0),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/replay", s.handleUpload)
+	mux.HandleFunc("/replay/status/", s.handleStatus)
+	mux.HandleFunc("/account/players", s.handlePlayers)
+
+	s.Server = httptest.NewServer(s.middleware(mux))
+
+	return s
+}
+
+// Client returns a client using the Server and its API key, which does not
+// retry failed requests unless given an sc2replaystats.WithRetryPolicy option
+func (s *Server) Client(opts ...sc2replaystats.Option) *sc2replaystats.Client {
+	s.mu.Lock()
+	key := s.apikey
+	s.mu.Unlock()
+
+	opts = append([]sc2replaystats.Option{
+		sc2replaystats.WithAPIRoot(s.URL),
+		sc2replaystats.WithRetryPolicy(sc2replaystats.RetryPolicy{Attempts: 1}),
+	}, opts...)
+
+	return sc2replaystats.New(key, opts...)
+}
+
+// SetAPIKey changes the only API key accepted
+func (s *Server) SetAPIKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.apikey = key
+}
+
+// SetPlayers changes the players listed by GET /account/players
+func (s *Server) SetPlayers(players []sc2replaystats.AccountPlayer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.players = players
+}
+
+// Script sets the Outcome of uploading any replay with the given file name
+func (s *Server) Script(filename string, outcome Outcome) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outcomes[filename] = outcome
+}
+
+// FailNext makes the next n requests of any kind fail with the given HTTP
+// status code, sending the Retry-After header given unless it is empty
+func (s *Server) FailNext(n int, status int, retryAfter string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := 0; i < n; i++ {
+		s.failures = append(s.failures, failure{status, retryAfter})
+	}
+}
+
+// Requests returns how many requests the Server received
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.requests
+}
+
+// Uploads returns every replay the Server received, in order
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Upload(nil), s.uploads...)
+}
+
+// middleware counts requests, checks the API key and applies FailNext
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests++
+
+		if len(s.failures) > 0 {
+			f := s.failures[0]
+			s.failures = s.failures[1:]
+			s.mu.Unlock()
+
+			if f.retryAfter != "" {
+				w.Header().Set("Retry-After", f.retryAfter)
+			}
+
+			writeJSON(w, f.status, map[string]string{"error": http.StatusText(f.status)})
+
+			return
+		}
+
+		key := r.Header.Get("Authorization")
+		authorized := key == s.apikey
+		s.mu.Unlock()
+
+		if !authorized {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "Method Not Allowed"})
+		return
+	}
+
+	f, header, err := r.FormFile("replay_file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing replay_file"})
+		return
+	}
+	defer f.Close()
+
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "bad replay_file"})
+		return
+	}
+
+	upload := Upload{
+		Filename: filepath.Base(filepath.FromSlash(strings.ReplaceAll(header.Filename, `\`, "/"))),
+		Size:     len(data),
+		Method:   r.FormValue("upload_method"),
+	}
+
+	s.mu.Lock()
+	outcome := s.outcomes[upload.Filename]
+	s.mu.Unlock()
+
+	time.Sleep(outcome.Delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if outcome.Status != 0 {
+		s.uploads = append(s.uploads, upload)
+		writeJSON(w, outcome.Status, map[string]string{"error": http.StatusText(outcome.Status)})
+
+		return
+	}
+
+	s.nextID++
+	upload.QueueID = strconv.Itoa(s.nextID)
+	s.uploads = append(s.uploads, upload)
+	s.queue[upload.QueueID] = &queued{outcome: outcome, hash: sha256.Sum256(data)}
+
+	writeJSON(w, http.StatusOK, map[string]string{"replay_queue_id": upload.QueueID})
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queue[strings.TrimPrefix(r.URL.Path, "/replay/status/")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "Replay Not Found"})
+		return
+	}
+
+	if q.polls < q.outcome.Polls {
+		q.polls++
+		writeJSON(w, http.StatusOK, map[string]string{})
+
+		return
+	}
+
+	switch {
+	case q.outcome.Fail != "":
+		writeJSON(w, http.StatusOK, map[string]string{"error": q.outcome.Fail})
+	case q.outcome.DuplicateOf != "":
+		writeJSON(w, http.StatusOK, map[string]string{"error": "Duplicate Replay: " + q.outcome.DuplicateOf})
+	default:
+		if q.replayID == "" {
+			// the first replay with the same contents is the original
+			if original, seen := s.hashes[q.hash]; seen {
+				q.outcome.DuplicateOf = original
+				writeJSON(w, http.StatusOK, map[string]string{"error": "Duplicate Replay: " + original})
+
+				return
+			}
+
+			s.nextID++
+			q.replayID = strconv.Itoa(s.nextID)
+			s.hashes[q.hash] = q.replayID
+		}
+
+		writeJSON(w, http.StatusOK, map[string]string{"replay_id": q.replayID})
+	}
+}
+
+func (s *Server) handlePlayers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, s.players)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		panic(fmt.Sprintf("sc2replaystatstest: %v", err))
+	}
+}
@@ -2,36 +2,86 @@ package sc2utils
 
 import (
 	"fmt"
-
-	"github.com/AlbinoGeek/sc2-rsu/utils"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
 )
 
-var multiplayerSuffix = "ultiplayer"
+// DefaultCategory is the replay category watched unless configured otherwise
+const DefaultCategory = "Multiplayer"
+
+// Toon is a StarCraft II profile found under a replays root
+type Toon struct {
+	// ID is "AccountID/ToonID", which is also the path of its folder
+	ID string
+
+	// Categories are the folders its replays are saved in, under its
+	// "Replays" folder, such as "Multiplayer" or "VersusAI"
+	Categories []string
+}
+
+// HasCategory returns whether the toon has a folder for a replay category
+func (t Toon) HasCategory(category string) bool {
+	for _, c := range t.Categories {
+		if c == category {
+			return true
+		}
+	}
+
+	return false
+}
 
-// EnumerateAccounts searches a given replaysRoot and returns a slice
-// containing the accounts and toons which could be found, in the format
-// "AccountID/ToonID" -- which is the same as their replay folder path.
-func EnumerateAccounts(replaysRoot string) (accountIDs []string, err error) {
-	paths, err := utils.FindDirectoriesBySuffix(replaysRoot, multiplayerSuffix, true)
+// EnumerateAccounts searches a given replaysRoot and returns the accounts
+// and toons which could be found, with the replay categories each has,
+// ordered by ID -- which is in the format "AccountID/ToonID", the same as
+// their replay folder path.
+func EnumerateAccounts(replaysRoot string) (toons []Toon, err error) {
+	accounts, err := ioutil.ReadDir(replaysRoot)
 	if err != nil {
-		return nil, fmt.Errorf("FindDirectory error: %v", err)
+		return nil, fmt.Errorf("ReadDir error: %v", err)
 	}
 
-	i := 0
-	uniq := make(map[string]struct{})
+	toons = make([]Toon, 0)
+
+	for _, acc := range accounts {
+		if !acc.IsDir() {
+			continue
+		}
+
+		dirs, err := ioutil.ReadDir(filepath.Join(replaysRoot, acc.Name()))
+		if err != nil {
+			continue // such as "permission denied"
+		}
+
+		for _, d := range dirs {
+			if !d.IsDir() || !strings.Contains(d.Name(), "-S2-") {
+				continue // not a toon, such as "Hotkeys"
+			}
 
-	for _, p := range paths {
-		// strip "/Replays/Multiplayer" suffix
-		p = utils.StripPathParts(p, 2)
+			id := filepath.Join(acc.Name(), d.Name())
 
-		if _, duplicate := uniq[p]; !duplicate {
-			uniq[p] = struct{}{}
+			categories, err := ioutil.ReadDir(filepath.Join(replaysRoot, id, "Replays"))
+			if err != nil {
+				continue // not a toon, or it never saved a replay
+			}
 
-			// strip replaysRoot prefix from resulting path
-			paths[i] = p[len(replaysRoot)+1:]
-			i++
+			toon := Toon{ID: id, Categories: make([]string, 0, len(categories))}
+			for _, c := range categories {
+				if c.IsDir() {
+					toon.Categories = append(toon.Categories, c.Name())
+				}
+			}
+
+			if len(toon.Categories) > 0 {
+				toons = append(toons, toon)
+			}
 		}
 	}
 
-	return paths[:i], nil
+	sort.Slice(toons, func(i, j int) bool {
+		return toons[i].ID < toons[j].ID
+	})
+
+	return toons, nil
 }
@@ -0,0 +1,57 @@
+package sc2utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+)
+
+// makeAccounts creates an "Accounts" folder in dir, with a few toons
+func makeAccounts(t *testing.T, dir string) string {
+	root := filepath.Join(dir, "StarCraft II", "Accounts")
+
+	for _, p := range []string{
+		"111/1-S2-1-100/Replays/Multiplayer",
+		"111/1-S2-1-100/Replays/VersusAI",
+		"111/2-S2-1-200/Replays/Custom",
+		"111/2-S2-1-200/Hotkeys",
+		"222/1-S2-1-300/Replays",
+		"222/Hotkeys",
+		"Replays/Not A Toon/Replays/Multiplayer",
+	} {
+		assert.Nil(t, os.MkdirAll(filepath.Join(root, filepath.FromSlash(p)), 0755), "must not error")
+	}
+
+	return root
+}
+
+func TestEnumerateAccounts(t *testing.T) {
+	root := makeAccounts(t, t.TempDir())
+
+	toons, err := sc2utils.EnumerateAccounts(root)
+	assert.Nil(t, err, "must not error")
+
+	assert.Equal(t, []sc2utils.Toon{
+		{ID: filepath.Join("111", "1-S2-1-100"), Categories: []string{"Multiplayer", "VersusAI"}},
+		{ID: filepath.Join("111", "2-S2-1-200"), Categories: []string{"Custom"}},
+	}, toons, "only toons with replay categories must be found")
+
+	assert.True(t, toons[0].HasCategory("VersusAI"), "categories must be found")
+	assert.False(t, toons[1].HasCategory("Multiplayer"), "missing categories must not be found")
+
+	_, err = sc2utils.EnumerateAccounts(filepath.Join(root, "missing"))
+	assert.NotNil(t, err, "missing replays roots must error")
+}
+
+func TestFindReplaysRoot(t *testing.T) {
+	dir := t.TempDir()
+	root := makeAccounts(t, dir)
+
+	roots, err := sc2utils.FindReplaysRoot(dir)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, []string{root}, roots, "only folders with toons must be found")
+}
@@ -2,6 +2,8 @@ package sc2utils
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 
 	"github.com/AlbinoGeek/sc2-rsu/utils"
 )
@@ -10,7 +12,7 @@ import (
 // all paths that seem like they could hold StarCraft II replays, organized
 // by sub-directories containing "<accountID>/<toonID>/Replays/<gameType>"
 func FindReplaysRoot(scanRoot string) (replayRoots []string, err error) {
-	paths, err := utils.FindDirectoriesBySuffix(scanRoot, multiplayerSuffix, true)
+	paths, err := utils.FindDirectoriesBySuffix(scanRoot, string(filepath.Separator)+"Replays", true)
 	if err != nil {
 		return nil, fmt.Errorf("FindDirectory error: %v", err)
 	}
@@ -19,8 +21,13 @@ func FindReplaysRoot(scanRoot string) (replayRoots []string, err error) {
 	uniq := make(map[string]struct{})
 
 	for _, p := range paths {
-		// strip "accountID/toonID/Replays/Multiplayer" suffix
-		p = utils.StripPathParts(p, 4)
+		// only "<toonID>/Replays", not any folder named "Replays"
+		if !strings.Contains(filepath.Base(filepath.Dir(p)), "-S2-") {
+			continue
+		}
+
+		// strip "accountID/toonID/Replays" suffix
+		p = utils.StripPathParts(p, 3)
 		if _, duplicate := uniq[p]; !duplicate && p != "/" {
 			uniq[p] = struct{}{}
 			paths[i] = p
@@ -0,0 +1,30 @@
+package sc2utils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ToonFromPath returns the toon handle, such as "1-S2-1-1234567", of the
+// replay stored at "<toonID>/Replays/<gameType>/<name>", or an empty string
+// if the replay is not stored under a toon's directory
+func ToonFromPath(replayFilename string) string {
+	toon := filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(replayFilename))))
+
+	if !strings.Contains(toon, "-S2-") {
+		return ""
+	}
+
+	return toon
+}
+
+// AccountFromPath returns the AccountID, such as "12345678", owning the toon
+// a replay is stored under (see ToonFromPath), or an empty string if the
+// replay is not stored under a toon's directory
+func AccountFromPath(replayFilename string) string {
+	if ToonFromPath(replayFilename) == "" {
+		return ""
+	}
+
+	return filepath.Base(filepath.Dir(filepath.Dir(filepath.Dir(filepath.Dir(replayFilename)))))
+}
@@ -0,0 +1,181 @@
+package sc2utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/kataras/golog"
+
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
+)
+
+// AccountWatcher reports the toons, and replay categories of toons, created
+// under a replays root while it is watched, such as when another Battle.net
+// account logs in, or a toon saves its first replay of a category
+type AccountWatcher struct {
+	closed chan struct{}
+	dirs   map[string]bool
+	done   chan struct{}
+	known  map[string]map[string]bool
+	once   sync.Once
+	root   string
+	toons  chan Toon
+	w      fswatch.Watcher
+}
+
+// WatchAccounts starts watching a replays root with w, which is closed along
+// with the AccountWatcher returned, or right away if an error is returned
+func WatchAccounts(replaysRoot string, w fswatch.Watcher) (*AccountWatcher, error) {
+	if _, err := EnumerateAccounts(replaysRoot); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	a := &AccountWatcher{
+		closed: make(chan struct{}),
+		dirs:   make(map[string]bool),
+		done:   make(chan struct{}),
+		known:  make(map[string]map[string]bool),
+		root:   replaysRoot,
+		toons:  make(chan Toon),
+		w:      w,
+	}
+
+	a.sync() // those found now are not new
+
+	go a.run()
+
+	return a, nil
+}
+
+// Toons receives every toon found, with only the categories it did not have
+// before, until the AccountWatcher is closed
+func (a *AccountWatcher) Toons() <-chan Toon {
+	return a.toons
+}
+
+// Close stops watching the replays root
+func (a *AccountWatcher) Close() error {
+	var err error
+
+	a.once.Do(func() {
+		close(a.closed)
+		err = a.w.Close()
+		<-a.done
+	})
+
+	return err
+}
+
+func (a *AccountWatcher) run() {
+	defer close(a.done)
+	defer close(a.toons)
+
+	for {
+		select {
+		case <-a.closed:
+			return
+		case ev, ok := <-a.w.Events():
+			if !ok {
+				return
+			}
+
+			switch ev.Op {
+			case fswatch.Create:
+				if s, err := os.Stat(ev.Name); err != nil || !s.IsDir() {
+					continue
+				}
+
+				for _, t := range a.sync() {
+					select {
+					case a.toons <- t:
+					case <-a.closed:
+						return
+					}
+				}
+			case fswatch.Remove:
+				if a.dirs[ev.Name] {
+					delete(a.dirs, ev.Name)
+					a.w.Remove(ev.Name)
+				}
+			}
+		case err, ok := <-a.w.Errors():
+			if !ok {
+				return
+			}
+
+			golog.Warnf("failed watching for new accounts: %v", err)
+		}
+	}
+}
+
+// sync watches every directory new toons or categories could be created in,
+// then returns the toons with categories not known before
+func (a *AccountWatcher) sync() []Toon {
+	a.watch(a.root, 0)
+
+	toons, err := EnumerateAccounts(a.root)
+	if err != nil {
+		golog.Warnf("failed to look for new accounts: %v", err)
+		return nil
+	}
+
+	found := make([]Toon, 0)
+
+	for _, t := range toons {
+		known, ok := a.known[t.ID]
+		if !ok {
+			known = make(map[string]bool)
+			a.known[t.ID] = known
+		}
+
+		added := Toon{ID: t.ID, Categories: make([]string, 0)}
+		for _, c := range t.Categories {
+			if !known[c] {
+				known[c] = true
+				added.Categories = append(added.Categories, c)
+			}
+		}
+
+		if len(added.Categories) > 0 {
+			found = append(found, added)
+		}
+	}
+
+	return found
+}
+
+// watch watches dir, and the directories below it down to the "Replays"
+// folder of each toon, "<AccountID>/<ToonID>/Replays" being at depth 3
+func (a *AccountWatcher) watch(dir string, depth int) {
+	if !a.dirs[dir] {
+		if err := a.w.Add(dir); err != nil {
+			golog.Warnf("cannot watch for new accounts: %v: %v", dir, err)
+			return
+		}
+
+		a.dirs[dir] = true
+	}
+
+	if depth == 3 {
+		return
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, f := range infos {
+		if !f.IsDir() ||
+			(depth == 1 && !strings.Contains(f.Name(), "-S2-")) ||
+			(depth == 2 && !strings.EqualFold(f.Name(), "Replays")) {
+			continue
+		}
+
+		a.watch(filepath.Join(dir, f.Name()), depth+1)
+	}
+}
@@ -0,0 +1,61 @@
+package sc2utils_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/fswatch"
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+)
+
+// nextToon waits for a toon to be found, or fails the test if it is not in time
+func nextToon(t *testing.T, a *sc2utils.AccountWatcher) sc2utils.Toon {
+	select {
+	case toon := <-a.Toons():
+		return toon
+	case <-time.After(5 * time.Second):
+		t.Fatal("no toon found")
+	}
+
+	return sc2utils.Toon{}
+}
+
+func TestWatchAccounts(t *testing.T) {
+	root := makeAccounts(t, t.TempDir())
+
+	a, err := sc2utils.WatchAccounts(root, fswatch.NewPoll(10*time.Millisecond))
+	assert.Nil(t, err, "must not error")
+
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "333", "1-S2-1-400", "Replays", "Multiplayer"), 0755), "must not error")
+	assert.Equal(t, sc2utils.Toon{
+		ID:         filepath.Join("333", "1-S2-1-400"),
+		Categories: []string{"Multiplayer"},
+	}, nextToon(t, a), "new accounts must be found")
+
+	// not toons, so the next one found must be that below
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "333", "Not A Toon", "Replays", "Multiplayer"), 0755), "must not error")
+
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "222", "1-S2-1-300", "Replays", "Custom"), 0755), "must not error")
+	assert.Equal(t, sc2utils.Toon{
+		ID:         filepath.Join("222", "1-S2-1-300"),
+		Categories: []string{"Custom"},
+	}, nextToon(t, a), "toons saving their first replay must be found")
+
+	assert.Nil(t, os.Mkdir(filepath.Join(root, "111", "1-S2-1-100", "Replays", "Custom"), 0755), "must not error")
+	assert.Equal(t, sc2utils.Toon{
+		ID:         filepath.Join("111", "1-S2-1-100"),
+		Categories: []string{"Custom"},
+	}, nextToon(t, a), "only new categories must be found")
+
+	assert.Nil(t, a.Close(), "must not error")
+
+	_, ok := <-a.Toons()
+	assert.False(t, ok, "toons must be closed")
+
+	_, err = sc2utils.WatchAccounts(filepath.Join(root, "missing"), fswatch.NewPoll(time.Second))
+	assert.NotNil(t, err, "missing replays roots must error")
+}
@@ -0,0 +1,243 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt parameters deriving the key of an encrypted file from a passphrase
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// File is a Store kept in a file, encrypted (XSalsa20 and Poly1305) with a
+// key derived (scrypt) from a passphrase
+type File struct {
+	filename   string
+	key        *[32]byte
+	mu         sync.Mutex
+	passphrase PassphraseFunc
+	salt       []byte
+	secrets    map[string]string
+}
+
+// fileEnvelope is how an encrypted file is stored on disk
+type fileEnvelope struct {
+	Salt  []byte `json:"salt"`
+	Nonce []byte `json:"nonce"`
+	Data  []byte `json:"data"`
+}
+
+// NewFile returns the encrypted file at filename, which is created once the
+// first secret is Set; passphrase is asked for when first needed
+func NewFile(filename string, passphrase PassphraseFunc) *File {
+	return &File{
+		filename:   filename,
+		passphrase: passphrase,
+	}
+}
+
+// Get returns the secret stored under name, or ErrNotFound
+func (f *File) Get(name string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return "", err
+	}
+
+	secret, ok := f.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return secret, nil
+}
+
+// Set stores a secret under name, replacing any stored before
+func (f *File) Set(name, secret string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.secrets[name] = secret
+
+	return f.save()
+}
+
+// Delete forgets the secret stored under name, if any
+func (f *File) Delete(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	if _, ok := f.secrets[name]; !ok {
+		return nil
+	}
+
+	delete(f.secrets, name)
+
+	return f.save()
+}
+
+func (f *File) String() string {
+	return fmt.Sprintf("encrypted file %s", f.filename)
+}
+
+// load reads and decrypts the file once, asking for the passphrase; a file
+// which does not exist yet holds no secrets, and needs no passphrase until
+// it is saved
+func (f *File) load() error {
+	if f.secrets != nil {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(f.filename)
+	if os.IsNotExist(err) {
+		f.secrets = make(map[string]string)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to read secrets: %v", err)
+	}
+
+	var env fileEnvelope
+	if err = json.Unmarshal(data, &env); err != nil || len(env.Nonce) != 24 {
+		return fmt.Errorf("failed to read secrets: %v: not an encrypted secrets file", f.filename)
+	}
+
+	f.salt = env.Salt
+	if err = f.derive(); err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], env.Nonce)
+
+	plain, ok := secretbox.Open(nil, env.Data, &nonce, f.key)
+	if !ok {
+		f.key = nil
+		return fmt.Errorf("failed to decrypt secrets: %v: %w", f.filename, ErrPassphrase)
+	}
+
+	secrets := make(map[string]string)
+	if err = json.Unmarshal(plain, &secrets); err != nil {
+		return fmt.Errorf("failed to decode secrets: %v", err)
+	}
+
+	f.secrets = secrets
+
+	return nil
+}
+
+// derive asks for the passphrase and derives the key from it
+func (f *File) derive() error {
+	if f.passphrase == nil {
+		return fmt.Errorf("%w: no passphrase for %v", ErrUnavailable, f.filename)
+	}
+
+	passphrase, err := f.passphrase()
+	if err != nil {
+		return fmt.Errorf("failed to get passphrase: %v", err)
+	}
+
+	if passphrase == "" {
+		return fmt.Errorf("%w: empty passphrase", ErrPassphrase)
+	}
+
+	k, err := scrypt.Key([]byte(passphrase), f.salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return fmt.Errorf("failed to derive key: %v", err)
+	}
+
+	f.key = new([32]byte)
+	copy(f.key[:], k)
+
+	return nil
+}
+
+// save encrypts and writes all secrets, replacing the file at once so that it
+// is never left half written
+func (f *File) save() error {
+	if f.key == nil {
+		salt, err := random(32)
+		if err != nil {
+			return err
+		}
+
+		f.salt = salt
+		if err = f.derive(); err != nil {
+			return err
+		}
+	}
+
+	plain, err := json.Marshal(f.secrets)
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %v", err)
+	}
+
+	n, err := random(24)
+	if err != nil {
+		return err
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], n)
+
+	data, err := json.Marshal(fileEnvelope{
+		Salt:  f.salt,
+		Nonce: n,
+		Data:  secretbox.Seal(nil, plain, &nonce, f.key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode secrets: %v", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(f.filename), filepath.Base(f.filename)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write secrets: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.filename)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to write secrets: %v", err)
+	}
+
+	return nil
+}
+
+func random(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, fmt.Errorf("failed to generate random bytes: %v", err)
+	}
+
+	return b, nil
+}
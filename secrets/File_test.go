@@ -0,0 +1,83 @@
+package secrets_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/secrets"
+)
+
+func passphrase(p string, asked *int) secrets.PassphraseFunc {
+	return func() (string, error) {
+		*asked++
+		return p, nil
+	}
+}
+
+func TestFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "secrets")
+
+	var asked int
+	f := secrets.NewFile(name, passphrase("hunter2", &asked))
+
+	_, err := f.Get("apikey")
+	assert.True(t, errors.Is(err, secrets.ErrNotFound), "missing secrets must not be found")
+
+	assert.Nil(t, f.Set("apikey", "0123456789abcdef"), "must not error")
+	assert.Nil(t, f.Set("other", "secret"), "must not error")
+	assert.Nil(t, f.Delete("other"), "must not error")
+	assert.Nil(t, f.Delete("never-set"), "deleting missing secrets must not error")
+	assert.Equal(t, 1, asked, "passphrase must only be asked once")
+
+	data, err := ioutil.ReadFile(name)
+	assert.Nil(t, err, "must not error")
+	assert.False(t, strings.Contains(string(data), "0123456789abcdef"), "secrets must be encrypted")
+
+	s, err := os.Stat(name)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, os.FileMode(0600), s.Mode().Perm(), "file must only be readable by its owner")
+
+	// read back with the right passphrase
+	f = secrets.NewFile(name, passphrase("hunter2", &asked))
+
+	secret, err := f.Get("apikey")
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, "0123456789abcdef", secret, "secret must be read back")
+
+	_, err = f.Get("other")
+	assert.True(t, errors.Is(err, secrets.ErrNotFound), "deleted secrets must not be found")
+
+	// and with the wrong one
+	f = secrets.NewFile(name, passphrase("hunter3", &asked))
+
+	_, err = f.Get("apikey")
+	assert.True(t, errors.Is(err, secrets.ErrPassphrase), "wrong passphrase must be reported")
+	assert.True(t, errors.Is(f.Set("apikey", "x"), secrets.ErrPassphrase), "wrong passphrase must not overwrite")
+}
+
+func TestFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	var asked int
+	_, err := secrets.NewFile(filepath.Join(dir, "new"), passphrase("hunter2", &asked)).Get("apikey")
+	assert.True(t, errors.Is(err, secrets.ErrNotFound), "missing files must hold no secrets")
+	assert.Equal(t, 0, asked, "missing files must not need a passphrase")
+
+	err = secrets.NewFile(filepath.Join(dir, "none"), nil).Set("apikey", "x")
+	assert.True(t, errors.Is(err, secrets.ErrUnavailable), "files without passphrase must be unavailable")
+
+	err = secrets.NewFile(filepath.Join(dir, "empty"), passphrase("", &asked)).Set("apikey", "x")
+	assert.True(t, errors.Is(err, secrets.ErrPassphrase), "empty passphrases must be refused")
+
+	name := filepath.Join(dir, "garbage")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("apikey: plaintext"), 0600), "must not error")
+
+	_, err = secrets.NewFile(name, passphrase("hunter2", &asked)).Get("apikey")
+	assert.NotNil(t, err, "other files must not be read")
+}
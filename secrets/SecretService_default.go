@@ -0,0 +1,10 @@
+// +build !linux
+
+package secrets
+
+// NewSecretService would return the desktop's default keyring, but the
+// Secret Service API is only available on Linux
+// TODO: macOS Keychain and Windows Credential Manager
+func NewSecretService(application string) (Store, error) {
+	return nil, ErrUnavailable
+}
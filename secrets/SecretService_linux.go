@@ -0,0 +1,230 @@
+// +build linux
+
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	ssDest       = "org.freedesktop.secrets"
+	ssPath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	ssService    = "org.freedesktop.Secret.Service"
+	ssCollection = "org.freedesktop.Secret.Collection"
+	ssItem       = "org.freedesktop.Secret.Item"
+	ssPrompt     = "org.freedesktop.Secret.Prompt"
+
+	// ssNoPrompt is returned instead of a prompt when none is needed
+	ssNoPrompt = dbus.ObjectPath("/")
+
+	// ssPromptTimeout is how long the user has to answer a prompt, such as
+	// for unlocking the keyring
+	ssPromptTimeout = time.Minute * 2
+)
+
+// ssSecret is the Secret struct of the Secret Service API
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretService is a Store kept in the desktop's keyring, such as GNOME
+// Keyring or KWallet, through the freedesktop.org Secret Service API
+type secretService struct {
+	application string
+	collection  dbus.ObjectPath
+	conn        *dbus.Conn
+	session     dbus.ObjectPath
+}
+
+// NewSecretService returns the desktop's default keyring, in which secrets
+// are labelled with and looked up by the application's name, or an error
+// wrapping ErrUnavailable if there is no D-Bus session or Secret Service
+func NewSecretService(application string) (Store, error) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, fmt.Errorf("%w: no D-Bus session", ErrUnavailable)
+	}
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	s := &secretService{application: application, conn: conn}
+	svc := conn.Object(ssDest, ssPath)
+
+	var output dbus.Variant
+	if err = svc.Call(ssService+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &s.session); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if err = svc.Call(ssService+".ReadAlias", 0, "default").Store(&s.collection); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+
+	if s.collection == ssNoPrompt {
+		return nil, fmt.Errorf("%w: no default keyring", ErrUnavailable)
+	}
+
+	return s, nil
+}
+
+// Get returns the secret stored under name, or ErrNotFound
+func (s *secretService) Get(name string) (string, error) {
+	items, err := s.search(name)
+	if err != nil {
+		return "", err
+	}
+
+	if len(items) == 0 {
+		return "", ErrNotFound
+	}
+
+	var secret ssSecret
+	if err = s.conn.Object(ssDest, items[0]).Call(ssItem+".GetSecret", 0, s.session).Store(&secret); err != nil {
+		return "", fmt.Errorf("failed to get secret: %v", err)
+	}
+
+	return string(secret.Value), nil
+}
+
+// Set stores a secret under name, replacing any stored before
+func (s *secretService) Set(name, secret string) error {
+	if err := s.unlock(s.collection); err != nil {
+		return err
+	}
+
+	props := map[string]dbus.Variant{
+		ssItem + ".Label":      dbus.MakeVariant(fmt.Sprintf("%s: %s", s.application, name)),
+		ssItem + ".Attributes": dbus.MakeVariant(s.attributes(name)),
+	}
+
+	value := ssSecret{
+		Session:     s.session,
+		Value:       []byte(secret),
+		ContentType: "text/plain; charset=utf8",
+	}
+
+	var item, prompt dbus.ObjectPath
+	if err := s.conn.Object(ssDest, s.collection).Call(ssCollection+".CreateItem", 0, props, value, true).Store(&item, &prompt); err != nil {
+		return fmt.Errorf("failed to store secret: %v", err)
+	}
+
+	return s.prompt(prompt)
+}
+
+// Delete forgets the secret stored under name, if any
+func (s *secretService) Delete(name string) error {
+	items, err := s.search(name)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var prompt dbus.ObjectPath
+		if err = s.conn.Object(ssDest, item).Call(ssItem+".Delete", 0).Store(&prompt); err != nil {
+			return fmt.Errorf("failed to delete secret: %v", err)
+		}
+
+		if err = s.prompt(prompt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *secretService) String() string {
+	return "keyring (Secret Service)"
+}
+
+func (s *secretService) attributes(name string) map[string]string {
+	return map[string]string{
+		"application": s.application,
+		"name":        name,
+	}
+}
+
+// search returns the items holding the secret stored under name, unlocking
+// them if they are locked
+func (s *secretService) search(name string) ([]dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.conn.Object(ssDest, ssPath).Call(ssService+".SearchItems", 0, s.attributes(name)).Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("failed to search secrets: %v", err)
+	}
+
+	if len(locked) > 0 {
+		if err := s.unlock(locked...); err != nil {
+			return nil, err
+		}
+	}
+
+	return append(unlocked, locked...), nil
+}
+
+// unlock unlocks the keyring or items given, prompting the user if needed
+func (s *secretService) unlock(paths ...dbus.ObjectPath) error {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+
+	if err := s.conn.Object(ssDest, ssPath).Call(ssService+".Unlock", 0, paths).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("failed to unlock keyring: %v", err)
+	}
+
+	return s.prompt(prompt)
+}
+
+// prompt shows a prompt (if any) to the user and waits for its answer
+func (s *secretService) prompt(path dbus.ObjectPath) error {
+	if path == ssNoPrompt || path == "" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(path),
+		dbus.WithMatchInterface(ssPrompt),
+		dbus.WithMatchMember("Completed"),
+	}
+
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return fmt.Errorf("failed to wait for keyring prompt: %v", err)
+	}
+	defer s.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+
+	if err := s.conn.Object(ssDest, path).Call(ssPrompt+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("failed to show keyring prompt: %v", err)
+	}
+
+	timeout := time.NewTimer(ssPromptTimeout)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != path || len(sig.Body) == 0 {
+				continue
+			}
+
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return errors.New("keyring prompt was dismissed")
+			}
+
+			return nil
+		case <-timeout.C:
+			return errors.New("keyring prompt was not answered in time")
+		}
+	}
+}
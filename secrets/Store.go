@@ -0,0 +1,37 @@
+// Package secrets keeps secrets, such as API keys, out of the configuration
+// file: in the desktop's keyring (see NewSecretService), or in a file
+// encrypted with a passphrase (see NewFile).
+package secrets
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by Get for secrets which were never Set
+	ErrNotFound = errors.New("secret not found")
+
+	// ErrPassphrase means an encrypted file could not be opened with the
+	// passphrase given
+	ErrPassphrase = errors.New("wrong passphrase")
+
+	// ErrUnavailable means a kind of Store cannot be used on this system
+	ErrUnavailable = errors.New("secret storage unavailable")
+)
+
+// Store keeps secrets by name
+type Store interface {
+	// Get returns the secret stored under name, or ErrNotFound
+	Get(name string) (string, error)
+
+	// Set stores a secret under name, replacing any stored before
+	Set(name, secret string) error
+
+	// Delete forgets the secret stored under name, if any
+	Delete(name string) error
+
+	// String describes where the secrets are kept, for showing to the user
+	String() string
+}
+
+// PassphraseFunc asks the user for the passphrase protecting an encrypted
+// file, and is only called once the file is first read or written
+type PassphraseFunc func() (string, error)
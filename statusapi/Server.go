@@ -0,0 +1,420 @@
+// Package statusapi serves a small HTTP/JSON API reporting what the uploader
+// is doing (uploads in-flight and past, toons, watched directories and recent
+// errors) and letting toons be paused or resumed and failed uploads retried,
+// meant to be listened for on localhost only.
+package statusapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+// maxErrors is how many of the most recent errors are kept
+const maxErrors = 20
+
+var (
+	// ErrNotFound is returned by a Controller for an unknown toon or replay
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict is returned by a Controller refusing a change, such as
+	// pausing the last toon enabled
+	ErrConflict = errors.New("conflict")
+)
+
+// requestError means a request was malformed
+type requestError struct {
+	msg string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+// Controller is the program the API reports on and controls
+type Controller interface {
+	// Toons returns every toon found, and whether its replays are uploaded
+	Toons() []Toon
+
+	// SetToonEnabled starts or stops uploading the replays of a toon
+	SetToonEnabled(toon string, enabled bool) error
+
+	// WatchPaths returns the directories watched for new replays
+	WatchPaths() []string
+
+	// Retry uploads a replay again, returning once it was queued
+	Retry(replayFilename string) error
+}
+
+// Toon is a StarCraft II profile, whose replays are stored in Path, in a
+// folder for each of its Categories, of which those Watched are uploaded
+type Toon struct {
+	ID         string   `json:"id"`
+	Enabled    bool     `json:"enabled"`
+	Path       string   `json:"path"`
+	Categories []string `json:"categories"`
+	Watched    []string `json:"watched"`
+}
+
+// Upload is a replay being uploaded, as last reported by the uploader
+type Upload struct {
+	Filename string    `json:"filename"`
+	MapName  string    `json:"map_name"`
+	Status   string    `json:"status"`
+	QueueID  string    `json:"queue_id,omitempty"`
+	Size     int64     `json:"size,omitempty"`
+	Sent     int64     `json:"sent,omitempty"`
+	Total    int64     `json:"total,omitempty"`
+	Polls    int       `json:"polls,omitempty"`
+	Started  time.Time `json:"started"`
+	Updated  time.Time `json:"updated"`
+}
+
+// Error is a replay which failed to upload
+type Error struct {
+	Time     time.Time `json:"time"`
+	Filename string    `json:"filename"`
+	Error    string    `json:"error"`
+}
+
+// Status is everything reported at once, by "/api/status"
+type Status struct {
+	Version    string    `json:"version"`
+	Started    time.Time `json:"started"`
+	Queue      []*Upload `json:"queue"`
+	Toons      []Toon    `json:"toons"`
+	WatchPaths []string  `json:"watch_paths"`
+	Errors     []Error   `json:"errors"`
+}
+
+// Server is the http.Handler serving the API, which follows the uploader by
+// being subscribed to it (see OnEvent); it only answers requests addressed to
+// localhost, so that websites cannot reach it through the user's browser
+type Server struct {
+	// Version is reported as is by "/api/status"
+	Version string
+
+	ctl     Controller
+	errors  []Error
+	ledger  *ledger.Ledger
+	mu      sync.Mutex
+	mux     *http.ServeMux
+	queue   map[string]*Upload
+	started time.Time
+}
+
+// New returns a Server reporting on ctl, and on past uploads recorded in the
+// ledger, which may be nil
+func New(ctl Controller, l *ledger.Ledger) *Server {
+	s := &Server{
+		ctl:     ctl,
+		errors:  make([]Error, 0),
+		ledger:  l,
+		mux:     http.NewServeMux(),
+		queue:   make(map[string]*Upload),
+		started: time.Now(),
+	}
+
+	s.mux.HandleFunc("/api/status", s.get(s.handleStatus))
+	s.mux.HandleFunc("/api/queue", s.get(func(r *http.Request) (interface{}, error) { return s.Queue(), nil }))
+	s.mux.HandleFunc("/api/history", s.get(s.handleHistory))
+	s.mux.HandleFunc("/api/history/", s.post("/api/history/", "/retry", s.handleRetry))
+	s.mux.HandleFunc("/api/toons", s.get(func(r *http.Request) (interface{}, error) { return s.ctl.Toons(), nil }))
+	s.mux.HandleFunc("/api/toons/", s.post("/api/toons/", "", s.handleToon))
+	s.mux.HandleFunc("/api/watcher", s.get(func(r *http.Request) (interface{}, error) {
+		return map[string][]string{"paths": s.ctl.WatchPaths()}, nil
+	}))
+	s.mux.HandleFunc("/api/errors", s.get(func(r *http.Request) (interface{}, error) { return s.Errors(), nil }))
+
+	return s
+}
+
+// OnEvent follows the uploader, to be passed to uploader.Subscribe
+func (s *Server) OnEvent(ev uploader.Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ev.Type == uploader.EventFailed {
+		s.errors = append(s.errors, Error{Time: ev.Time, Filename: ev.Filename, Error: ev.Err.Error()})
+		if len(s.errors) > maxErrors {
+			s.errors = s.errors[len(s.errors)-maxErrors:]
+		}
+	}
+
+	if ev.Type.Done() {
+		delete(s.queue, ev.Filename)
+		return
+	}
+
+	up, ok := s.queue[ev.Filename]
+	if !ok {
+		up = &Upload{Filename: ev.Filename, MapName: ev.MapName, Started: ev.Time}
+		s.queue[ev.Filename] = up
+	}
+
+	if ev.Type != uploader.EventProgress {
+		up.Status = ev.Type.String()
+	}
+
+	if ev.QueueID != "" {
+		up.QueueID = ev.QueueID
+	}
+
+	if ev.Size > 0 {
+		up.Size = ev.Size
+	}
+
+	if ev.Total > 0 {
+		up.Sent, up.Total = ev.Sent, ev.Total
+	}
+
+	up.Polls = ev.Polls
+	up.Updated = ev.Time
+}
+
+// Queue returns the replays being uploaded, oldest first
+func (s *Server) Queue() []*Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := make([]*Upload, 0, len(s.queue))
+	for _, up := range s.queue {
+		c := *up
+		queue = append(queue, &c)
+	}
+
+	sort.Slice(queue, func(i, j int) bool {
+		return queue[i].Started.Before(queue[j].Started)
+	})
+
+	return queue
+}
+
+// Errors returns the most recent replays which failed to upload, oldest first
+func (s *Server) Errors() []Error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Error{}, s.errors...)
+}
+
+// ServeHTTP answers requests addressed to localhost, and refuses requests
+// changing anything that were sent from other websites
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !loopback(r.Host) {
+		writeError(w, http.StatusForbidden, errors.New("only requests to localhost are allowed"))
+		return
+	}
+
+	if origin := r.Header.Get("Origin"); origin != "" && r.Method != http.MethodGet {
+		if u, err := url.Parse(origin); err != nil || !loopback(u.Host) {
+			writeError(w, http.StatusForbidden, errors.New("cross-origin requests are not allowed"))
+			return
+		}
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleStatus(r *http.Request) (interface{}, error) {
+	return &Status{
+		Version:    s.Version,
+		Started:    s.started,
+		Queue:      s.Queue(),
+		Toons:      s.ctl.Toons(),
+		WatchPaths: s.ctl.WatchPaths(),
+		Errors:     s.Errors(),
+	}, nil
+}
+
+// handleHistory lists the replays recorded in the ledger, most recently
+// updated first, optionally only those with the "status" given, up to
+// "limit" of them (50 by default)
+func (s *Server) handleHistory(r *http.Request) (interface{}, error) {
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			return nil, &requestError{fmt.Sprintf("invalid limit: %q", l)}
+		}
+
+		limit = n
+	}
+
+	history := make([]*ledger.Entry, 0)
+	if s.ledger == nil {
+		return history, nil
+	}
+
+	entries, err := s.ledger.List()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Updated.After(entries[j].Updated)
+	})
+
+	status := ledger.Status(r.URL.Query().Get("status"))
+	for _, e := range entries {
+		if len(history) == limit {
+			break
+		}
+
+		if status == "" || e.Status == status {
+			history = append(history, e)
+		}
+	}
+
+	return history, nil
+}
+
+// handleRetry uploads a replay which failed again, "/api/history/<hash>"
+func (s *Server) handleRetry(hash string) (interface{}, error) {
+	if s.ledger == nil {
+		return nil, ErrNotFound
+	}
+
+	e, err := s.ledger.Get(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	if e == nil {
+		return nil, ErrNotFound
+	}
+
+	if e.Status != ledger.StatusFailed {
+		return nil, fmt.Errorf("%w: replay is %s, only failed uploads can be retried", ErrConflict, e.Status)
+	}
+
+	if err = s.ctl.Retry(e.Filename); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// handleToon pauses or resumes a toon, "/api/toons/<toon>/pause" or
+// "/api/toons/<toon>/resume", where toon is "AccountID/ToonID"
+func (s *Server) handleToon(path string) (interface{}, error) {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return nil, ErrNotFound
+	}
+
+	toon, action := path[:i], path[i+1:]
+
+	var enabled bool
+
+	switch action {
+	case "pause":
+	case "resume":
+		enabled = true
+	default:
+		return nil, ErrNotFound
+	}
+
+	if err := s.ctl.SetToonEnabled(toon, enabled); err != nil {
+		return nil, err
+	}
+
+	for _, t := range s.ctl.Toons() {
+		if t.ID == toon {
+			return t, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// get returns a handler answering GET requests with what fn returns
+func (s *Server) get(fn func(*http.Request) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		v, err := fn(r)
+		respond(w, v, err)
+	}
+}
+
+// post returns a handler answering POST requests to paths starting with
+// prefix and ending in suffix, with what fn returns for the part in between
+func (s *Server) post(prefix, suffix string, fn func(string) (interface{}, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.TrimPrefix(r.URL.Path, prefix)
+		if !strings.HasSuffix(rest, suffix) || strings.TrimSuffix(rest, suffix) == "" {
+			writeError(w, http.StatusNotFound, ErrNotFound)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+
+		v, err := fn(strings.TrimSuffix(rest, suffix))
+		respond(w, v, err)
+	}
+}
+
+func respond(w http.ResponseWriter, v interface{}, err error) {
+	var reqErr *requestError
+
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, v)
+	case errors.As(err, &reqErr):
+		writeError(w, http.StatusBadRequest, err)
+	case errors.Is(err, ErrNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, ErrConflict):
+		writeError(w, http.StatusConflict, err)
+	default:
+		writeError(w, http.StatusInternalServerError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// loopback returns whether a host (with or without port) is localhost
+func loopback(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+
+	return ip != nil && ip.IsLoopback()
+}
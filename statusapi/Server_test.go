@@ -0,0 +1,142 @@
+package statusapi_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+	"github.com/AlbinoGeek/sc2-rsu/statusapi"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+// controller is a fake program, with toons "1/a" (enabled) and "1/b"
+type controller struct {
+	toons   map[string]bool
+	retried []string
+}
+
+func (c *controller) Toons() []statusapi.Toon {
+	return []statusapi.Toon{
+		{ID: "1/a", Enabled: c.toons["1/a"], Path: "/replays/1/a"},
+		{ID: "1/b", Enabled: c.toons["1/b"], Path: "/replays/1/b"},
+	}
+}
+
+func (c *controller) SetToonEnabled(toon string, enabled bool) error {
+	if _, ok := c.toons[toon]; !ok {
+		return statusapi.ErrNotFound
+	}
+
+	c.toons[toon] = enabled
+
+	return nil
+}
+
+func (c *controller) WatchPaths() []string {
+	return []string{"/replays/1/a"}
+}
+
+func (c *controller) Retry(replayFilename string) error {
+	c.retried = append(c.retried, replayFilename)
+	return nil
+}
+
+func request(s http.Handler, method, target string, v interface{}) int {
+	r := httptest.NewRequest(method, target, nil)
+	r.Host = "localhost:8765"
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+
+	if v != nil {
+		json.NewDecoder(w.Body).Decode(v)
+	}
+
+	return w.Code
+}
+
+func TestServer(t *testing.T) {
+	l, err := ledger.Open(filepath.Join(t.TempDir(), "ledger.db"))
+	assert.Nil(t, err, "must not error")
+	defer l.Close()
+
+	assert.Nil(t, l.Put(&ledger.Entry{Hash: "ok", Filename: "ok.SC2Replay", Status: ledger.StatusSuccess}), "must not error")
+	assert.Nil(t, l.Put(&ledger.Entry{Hash: "bad", Filename: "bad.SC2Replay", Status: ledger.StatusFailed}), "must not error")
+
+	ctl := &controller{toons: map[string]bool{"1/a": true, "1/b": false}}
+	s := statusapi.New(ctl, l)
+	s.Version = "test"
+
+	now := time.Now()
+	s.OnEvent(uploader.Event{Type: uploader.EventQueued, Filename: "new.SC2Replay", MapName: "new", Time: now})
+	s.OnEvent(uploader.Event{Type: uploader.EventProgress, Filename: "new.SC2Replay", Sent: 10, Total: 20, Time: now})
+	s.OnEvent(uploader.Event{Type: uploader.EventQueued, Filename: "bad.SC2Replay", Time: now})
+	s.OnEvent(uploader.Event{Type: uploader.EventFailed, Filename: "bad.SC2Replay", Err: errors.New("boom"), Time: now})
+
+	var status statusapi.Status
+	assert.Equal(t, http.StatusOK, request(s, http.MethodGet, "/api/status", &status), "must succeed")
+	assert.Equal(t, "test", status.Version, "version must be reported")
+	assert.Equal(t, 1, len(status.Queue), "finished uploads must leave the queue")
+	assert.Equal(t, "queued", status.Queue[0].Status, "progress must not change the status")
+	assert.Equal(t, int64(10), status.Queue[0].Sent, "progress must be reported")
+	assert.Equal(t, []string{"/replays/1/a"}, status.WatchPaths, "watch paths must be reported")
+	assert.Equal(t, 1, len(status.Errors), "errors must be reported")
+	assert.Equal(t, "boom", status.Errors[0].Error, "errors must be reported")
+
+	var history []ledger.Entry
+	assert.Equal(t, http.StatusOK, request(s, http.MethodGet, "/api/history?status=failed", &history), "must succeed")
+	assert.Equal(t, 1, len(history), "history must be filtered by status")
+	assert.Equal(t, http.StatusOK, request(s, http.MethodGet, "/api/history?limit=1", &history), "must succeed")
+	assert.Equal(t, 1, len(history), "history must be limited")
+	assert.Equal(t, http.StatusBadRequest, request(s, http.MethodGet, "/api/history?limit=x", nil), "invalid limits must be refused")
+
+	var toon statusapi.Toon
+	assert.Equal(t, http.StatusOK, request(s, http.MethodPost, "/api/toons/1/b/resume", &toon), "must succeed")
+	assert.True(t, toon.Enabled, "toon must be resumed")
+	assert.Equal(t, http.StatusOK, request(s, http.MethodPost, "/api/toons/1/a/pause", &toon), "must succeed")
+	assert.False(t, ctl.toons["1/a"], "toon must be paused")
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodPost, "/api/toons/1/c/pause", nil), "unknown toons must not be found")
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodPost, "/api/toons/1/a/explode", nil), "unknown actions must not be found")
+	assert.Equal(t, http.StatusMethodNotAllowed, request(s, http.MethodGet, "/api/toons/1/a/pause", nil), "changes must be posted")
+
+	assert.Equal(t, http.StatusOK, request(s, http.MethodPost, "/api/history/bad/retry", nil), "must succeed")
+	assert.Equal(t, []string{"bad.SC2Replay"}, ctl.retried, "failed uploads must be retried")
+	assert.Equal(t, http.StatusConflict, request(s, http.MethodPost, "/api/history/ok/retry", nil), "only failed uploads may be retried")
+	assert.Equal(t, http.StatusNotFound, request(s, http.MethodPost, "/api/history/missing/retry", nil), "unknown replays must not be found")
+}
+
+func TestServerLocalhost(t *testing.T) {
+	s := statusapi.New(&controller{}, nil)
+
+	for _, host := range []string{"localhost:8765", "127.0.0.1:8765", "[::1]:8765", "localhost"} {
+		r := httptest.NewRequest(http.MethodGet, "/api/errors", nil)
+		r.Host = host
+
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusOK, w.Code, fmt.Sprintf("requests to %s must be answered", host))
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/errors", nil)
+	r.Host = "evil.example.com:8765"
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code, "requests to other hosts must be refused (DNS rebinding)")
+
+	r = httptest.NewRequest(http.MethodPost, "/api/toons/1/a/pause", nil)
+	r.Host = "localhost:8765"
+	r.Header.Set("Origin", "https://evil.example.com")
+
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code, "cross-origin changes must be refused")
+}
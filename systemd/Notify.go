@@ -0,0 +1,86 @@
+// Package systemd lets a program running as a systemd service tell systemd
+// about its state (see Notify) and keep its watchdog from restarting it (see
+// WatchdogInterval), as described by sd_notify(3) and sd_watchdog_enabled(3),
+// doing nothing when not run by systemd, and helps write its units (see
+// Quote).
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// States which may be sent by Notify, see sd_notify(3) for more
+const (
+	// Ready means startup finished, or a reload did
+	Ready = "READY=1"
+
+	// Reloading means the configuration is being reloaded
+	Reloading = "RELOADING=1"
+
+	// Stopping means the service is shutting down
+	Stopping = "STOPPING=1"
+
+	// Watchdog keeps the watchdog from considering the service hung
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns a state describing what the service is doing, in a way
+// meant to be shown to the user by "systemctl status"
+func Status(format string, args ...interface{}) string {
+	return "STATUS=" + fmt.Sprintf(format, args...)
+}
+
+// Notify sends states, one per line, to systemd; it returns false without
+// error when not run by systemd (or without NotifyAccess)
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+
+	// an abstract socket, see unix(7)
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %v", err)
+	}
+	defer conn.Close()
+
+	var msg []byte
+	for _, s := range states {
+		msg = append(append(msg, s...), '\n')
+	}
+
+	if _, err = conn.Write(msg); err != nil {
+		return false, fmt.Errorf("failed to notify systemd: %v", err)
+	}
+
+	return true, nil
+}
+
+// WatchdogInterval returns how often systemd expects Watchdog to be sent, or
+// zero if the watchdog is not enabled for this process
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil // meant for another process
+	}
+
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC: %q", usec)
+	}
+
+	return time.Duration(n) * time.Microsecond, nil
+}
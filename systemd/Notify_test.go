@@ -0,0 +1,83 @@
+package systemd_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/systemd"
+)
+
+// setenv sets environment variables until the returned func is called
+func setenv(vars map[string]string) func() {
+	old := make(map[string]string)
+
+	for k, v := range vars {
+		old[k] = os.Getenv(k)
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k, v := range old {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	defer setenv(map[string]string{"NOTIFY_SOCKET": ""})()
+
+	sent, err := systemd.Notify(systemd.Ready)
+	assert.Nil(t, err, "must not error")
+	assert.False(t, sent, "must do nothing without systemd")
+
+	socket := filepath.Join(t.TempDir(), "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if !assert.Nil(t, err, "must not error") {
+		return
+	}
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socket)
+
+	sent, err = systemd.Notify(systemd.Ready, systemd.Status("Watching %d directories", 2))
+	assert.Nil(t, err, "must not error")
+	assert.True(t, sent, "must notify systemd")
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, "READY=1\nSTATUS=Watching 2 directories\n", string(buf[:n]), "must send states")
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	defer setenv(map[string]string{"WATCHDOG_USEC": "", "WATCHDOG_PID": ""})()
+
+	var cases = []struct {
+		Usec     string
+		Pid      string
+		Interval time.Duration
+		Err      bool
+	}{
+		{"", "", 0, false},
+		{"30000000", "", time.Second * 30, false},
+		{"30000000", strconv.Itoa(os.Getpid()), time.Second * 30, false},
+		{"30000000", "1", 0, false},
+		{"soon", "", 0, true},
+	}
+
+	for _, c := range cases {
+		os.Setenv("WATCHDOG_USEC", c.Usec)
+		os.Setenv("WATCHDOG_PID", c.Pid)
+
+		interval, err := systemd.WatchdogInterval()
+		assert.Equal(t, c.Interval, interval, "interval must match: %v", c)
+		assert.Equal(t, c.Err, err != nil, "error must match: %v", c)
+	}
+}
@@ -0,0 +1,17 @@
+package systemd
+
+import "strings"
+
+// Quote returns arg as it must be written in the command line of a unit, such
+// as ExecStart=, for systemd to pass it to the program unchanged: quoted if
+// it holds spaces or quotes, and with specifiers ("%") and variables ("$")
+// escaped, see systemd.service(5) and systemd.unit(5)
+func Quote(arg string) string {
+	arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\") {
+		return arg
+	}
+
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+}
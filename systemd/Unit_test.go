@@ -0,0 +1,26 @@
+package systemd_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/systemd"
+)
+
+func TestQuote(t *testing.T) {
+	var cases = []struct {
+		Arg    string
+		Quoted string
+	}{
+		{"/usr/bin/sc2-rsu", "/usr/bin/sc2-rsu"},
+		{"/home/John Doe/.config/sc2-rsu.yaml", `"/home/John Doe/.config/sc2-rsu.yaml"`},
+		{`C:\Games "SC2"`, `"C:\\Games \"SC2\""`},
+		{"/tmp/100%/$HOME", "/tmp/100%%/$$HOME"},
+		{"", `""`},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.Quoted, systemd.Quote(c.Arg), "must be quoted: %v", c.Arg)
+	}
+}
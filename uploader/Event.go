@@ -0,0 +1,83 @@
+package uploader
+
+import "time"
+
+// EventType identifies which step of the upload pipeline a replay reached
+type EventType uint8
+
+const (
+	// EventQueued means a replay was found and will be uploaded
+	EventQueued EventType = iota
+
+	// EventUploading means a replay is being sent to sc2replaystats
+	EventUploading
+
+	// EventProcessing means sc2replaystats accepted the replay into its queue
+	EventProcessing
+
+	// EventSuccess means sc2replaystats finished processing the replay
+	EventSuccess
+
+	// EventDuplicate means sc2replaystats already had the replay
+	EventDuplicate
+
+	// EventSkipped means the ledger shows the replay was already uploaded
+	EventSkipped
+
+	// EventExcluded means the upload rules excluded the replay, see Reason
+	EventExcluded
+
+	// EventFailed means the replay could not be uploaded or processed
+	EventFailed
+
+	// EventProgress means an upload or processing replay moved along, see
+	// Sent, Total and Polls; it is emitted repeatedly between EventUploading
+	// and whichever event ends the upload
+	EventProgress
+)
+
+var eventNames = map[EventType]string{
+	EventQueued:     "queued",
+	EventUploading:  "uploading",
+	EventProcessing: "processing",
+	EventSuccess:    "success",
+	EventDuplicate:  "duplicate",
+	EventSkipped:    "skipped",
+	EventExcluded:   "excluded",
+	EventFailed:     "failed",
+	EventProgress:   "progress",
+}
+
+func (t EventType) String() string {
+	return eventNames[t]
+}
+
+// Done returns whether no further events will follow for the replay
+func (t EventType) Done() bool {
+	return t == EventSuccess || t == EventDuplicate || t == EventSkipped || t == EventExcluded || t == EventFailed
+}
+
+// Event is emitted to subscribers every time a replay moves along the
+// upload pipeline; it is a copy and safe to keep
+type Event struct {
+	Type     EventType
+	Time     time.Time
+	Filename string
+	MapName  string
+	QueueID  string
+	ReplayID string
+	Reason   string
+	Err      error
+
+	// Size is the size of the replay file in bytes, known from EventUploading
+	Size int64
+
+	// Sent and Total count the bytes of the upload request (the replay and
+	// the form around it) sent so far and in all, while uploading
+	Sent  int64
+	Total int64
+
+	// Polls counts how often the processing status was checked so far, while
+	// processing
+	Polls int
+}
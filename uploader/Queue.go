@@ -0,0 +1,267 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kataras/golog"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+)
+
+// DefaultWorkers is how many replays are uploaded at once, unless changed
+// with SetWorkers
+const DefaultWorkers = 2
+
+// DefaultMaxPolling is how long the processing status of a replay is checked
+// for, unless changed with SetMaxPolling
+const DefaultMaxPolling = 30 * time.Minute
+
+// ErrStillProcessing is the error of replays sc2replaystats was still
+// processing after the longest polling allowed (see SetMaxPolling)
+var ErrStillProcessing = errors.New("sc2replaystats is still processing the replay")
+
+// job is a replay queued for, or being handled by, a worker
+type job struct {
+	ctx      context.Context
+	done     chan Event
+	filename string
+	force    bool
+}
+
+// pending is a replay which sc2replaystats is processing, whose status is
+// checked along with all others every PollInterval
+type pending struct {
+	*job
+	client   *sc2replaystats.Client
+	polls    int
+	rec      *ledger.Entry
+	resolved chan struct{}
+	size     int64
+	started  time.Time
+}
+
+// SetWorkers changes how many replays are uploaded, and how many processing
+// statuses are checked, at once; replays beyond that wait in a queue
+func (u *Uploader) SetWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+
+	u.qmu.Lock()
+	defer u.qmu.Unlock()
+
+	u.workers = n
+	u.spawn()
+}
+
+// enqueue queues a replay for the next worker free, once it was written if
+// wait is set, returning the channel its last event is sent on
+func (u *Uploader) enqueue(ctx context.Context, replayFilename string, force, wait bool) <-chan Event {
+	done := make(chan Event, 1)
+
+	if !u.claim(replayFilename) {
+		done <- inFlight(replayFilename)
+		return done
+	}
+
+	u.wg.Add(1)
+	u.emit(Event{Type: EventQueued, Filename: replayFilename})
+
+	j := &job{ctx: ctx, done: done, filename: replayFilename, force: force}
+
+	if !wait {
+		u.push(j)
+		return done
+	}
+
+	// waiting takes no worker, which would otherwise sit idle meanwhile
+	go func() {
+		if err := u.waitWritten(ctx, replayFilename); err != nil {
+			u.finish(j, u.emit(Event{Type: EventFailed, Filename: replayFilename, Err: err}))
+			return
+		}
+
+		u.push(j)
+	}()
+
+	return done
+}
+
+// push adds a job to the queue, starting a worker for it if allowed
+func (u *Uploader) push(j *job) {
+	u.qmu.Lock()
+	defer u.qmu.Unlock()
+
+	u.queue = append(u.queue, j)
+	u.spawn()
+}
+
+// spawn starts as many workers as there are replays queued, up to the number
+// allowed; u.qmu must be held
+func (u *Uploader) spawn() {
+	for u.running < u.workers && u.running < len(u.queue) {
+		u.running++
+		go u.work()
+	}
+}
+
+// work handles the replays queued, until there are none left or more workers
+// than allowed
+func (u *Uploader) work() {
+	for {
+		u.qmu.Lock()
+		if len(u.queue) == 0 || u.running > u.workers {
+			u.running--
+			u.qmu.Unlock()
+
+			return
+		}
+
+		j := u.queue[0]
+		u.queue = u.queue[1:]
+		u.qmu.Unlock()
+
+		if err := j.ctx.Err(); err != nil {
+			u.finish(j, u.emit(Event{Type: EventFailed, Filename: j.filename, Err: err}))
+			continue
+		}
+
+		u.upload(j)
+	}
+}
+
+// finish ends the handling of a replay with its last event
+func (u *Uploader) finish(j *job, ev Event) {
+	u.release(j.filename)
+	j.done <- ev
+	u.wg.Done()
+}
+
+// follow checks the processing status of a replay uploaded until it is done,
+// or its context is cancelled, in which case the ledger is left as is, so
+// that Resume picks it up again
+func (u *Uploader) follow(p *pending) {
+	u.qmu.Lock()
+	u.pending[p] = true
+
+	if !u.polling {
+		u.polling = true
+		go u.poll()
+	}
+	u.qmu.Unlock()
+
+	go func() {
+		select {
+		case <-p.ctx.Done():
+			u.resolve(p, Event{Type: EventFailed, Filename: p.filename, QueueID: p.rec.QueueID, Size: p.size, Err: p.ctx.Err()})
+		case <-p.resolved:
+		}
+	}()
+}
+
+// resolve stops following a replay, ending its handling with ev, unless it
+// was resolved already
+func (u *Uploader) resolve(p *pending, ev Event) {
+	u.qmu.Lock()
+	ok := u.pending[p]
+	delete(u.pending, p)
+	u.qmu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	close(p.resolved)
+	u.finish(p.job, u.emit(ev))
+}
+
+// poll checks the processing status of every replay followed each
+// PollInterval, as many at once as there are workers, until none are left
+func (u *Uploader) poll() {
+	t := time.NewTicker(u.PollInterval)
+	defer t.Stop()
+
+	for range t.C {
+		u.qmu.Lock()
+		if len(u.pending) == 0 {
+			u.polling = false
+			u.qmu.Unlock()
+
+			return
+		}
+
+		batch := make([]*pending, 0, len(u.pending))
+		for p := range u.pending {
+			batch = append(batch, p)
+		}
+
+		slots := make(chan struct{}, u.workers)
+		u.qmu.Unlock()
+
+		var wg sync.WaitGroup
+
+		for _, p := range batch {
+			slots <- struct{}{}
+			wg.Add(1)
+
+			go func(p *pending) {
+				defer wg.Done()
+				u.checkStatus(p)
+				<-slots
+			}(p)
+		}
+
+		wg.Wait()
+	}
+}
+
+// checkStatus checks once whether sc2replaystats finished processing a
+// replay, resolving it if so, or if it has been processing for longer than
+// allowed
+func (u *Uploader) checkStatus(p *pending) {
+	u.mu.RLock()
+	maxPolling := u.maxPolling
+	u.mu.RUnlock()
+
+	rid, err := p.client.GetReplayStatusContext(p.ctx, p.rec.QueueID)
+	if p.ctx.Err() != nil {
+		return // resolved by follow
+	}
+
+	ev := Event{Filename: p.filename, QueueID: p.rec.QueueID, Size: p.size}
+	p.rec.ReplayID = rid
+
+	var dup *sc2replaystats.ErrDuplicate
+
+	switch {
+	case errors.As(err, &dup):
+		p.rec.ReplayID = dup.ReplayID
+		u.record(p.rec, ledger.StatusDuplicate, nil)
+		ev.Type, ev.ReplayID = EventDuplicate, dup.ReplayID
+	case err != nil:
+		u.record(p.rec, ledger.StatusFailed, err)
+		ev.Type, ev.Err = EventFailed, err
+	case rid != "":
+		u.record(p.rec, ledger.StatusSuccess, nil)
+		ev.Type, ev.ReplayID = EventSuccess, rid
+	case maxPolling > 0 && time.Since(p.started) > maxPolling:
+		err = fmt.Errorf("%w after %v", ErrStillProcessing, maxPolling)
+		u.record(p.rec, ledger.StatusFailed, err)
+		ev.Type, ev.Err = EventFailed, err
+	default:
+		p.polls++
+		golog.Debugf("sc2replaystats process..: [%v] %s", p.rec.QueueID, p.filename)
+
+		ev.Type, ev.Polls = EventProgress, p.polls
+		u.emit(ev)
+
+		return
+	}
+
+	u.resolve(p, ev)
+}
@@ -0,0 +1,613 @@
+package uploader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kataras/golog"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+	"github.com/AlbinoGeek/sc2-rsu/mpq"
+	"github.com/AlbinoGeek/sc2-rsu/rules"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replay"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/sc2utils"
+	"github.com/AlbinoGeek/sc2-rsu/utils"
+)
+
+// DefaultWriteTimeout is how long a newly created replay may take to be
+// written, unless changed with SetWriteTimeout
+const DefaultWriteTimeout = time.Minute
+
+// BackupExt is the extension of the copy StarCraft II sometimes writes a
+// replay to first, such as "1v1.SC2Replay.writeCacheBackup", which is then
+// renamed to the replay itself
+const BackupExt = ".writeCacheBackup"
+
+// ErrIncomplete is the error of replays which were not written completely
+// in time (see SetWriteTimeout)
+var ErrIncomplete = errors.New("replay was not written completely")
+
+// writeCheckInterval is how often a replay being written is checked
+const writeCheckInterval = time.Millisecond * 250
+
+// ReplayExt is the extension of StarCraft II replays, the only files uploaded
+const ReplayExt = ".SC2Replay"
+
+// progressInterval limits how often EventProgress is emitted while uploading
+const progressInterval = time.Millisecond * 250
+
+// Uploader sends replays to sc2replaystats and follows them until they were
+// processed, recording their progress in a Ledger (if any) and emitting an
+// Event to every subscriber each time a replay moves along; replays are
+// queued for a limited number of workers (see SetWorkers)
+type Uploader struct {
+	// PollInterval is how often the processing status of replays is checked
+	PollInterval time.Duration
+
+	accounts     map[string]*sc2replaystats.Client
+	active       map[string]bool
+	client       *sc2replaystats.Client
+	filters      rules.Set
+	ledger       *ledger.Ledger
+	maxPolling   time.Duration
+	mu           sync.RWMutex
+	pending      map[*pending]bool
+	polling      bool
+	qmu          sync.Mutex
+	queue        []*job
+	running      int
+	subscribers  []func(Event)
+	wg           sync.WaitGroup
+	workers      int
+	writeTimeout time.Duration
+}
+
+// New returns an Uploader using the given client, and ledger which is
+// optional and may be nil, in which case nothing is remembered
+func New(client *sc2replaystats.Client, l *ledger.Ledger) *Uploader {
+	return &Uploader{
+		PollInterval: time.Second,
+		active:       make(map[string]bool),
+		client:       client,
+		ledger:       l,
+		maxPolling:   DefaultMaxPolling,
+		pending:      make(map[*pending]bool),
+		queue:        make([]*job, 0),
+		subscribers:  make([]func(Event), 0),
+		workers:      DefaultWorkers,
+		writeTimeout: DefaultWriteTimeout,
+	}
+}
+
+// SetClient changes the client used for any uploads started afterwards,
+// such as when the API key was changed
+func (u *Uploader) SetClient(client *sc2replaystats.Client) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.client = client
+}
+
+// SetAccountClients changes the clients used for any uploads started
+// afterwards of replays stored under the given AccountIDs (see
+// sc2utils.AccountFromPath), such as when each account has its own API key;
+// replays of any other account are uploaded with the client of SetClient
+func (u *Uploader) SetAccountClients(clients map[string]*sc2replaystats.Client) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.accounts = clients
+}
+
+// Client returns the client which a replay would be uploaded with, or nil if
+// there is none for the account it is stored under
+func (u *Uploader) Client(replayFilename string) *sc2replaystats.Client {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	if client, ok := u.accounts[sc2utils.AccountFromPath(replayFilename)]; ok {
+		return client
+	}
+
+	return u.client
+}
+
+// SetMaxPolling changes how long the processing status of a replay is
+// checked for before it fails with ErrStillProcessing, or zero for no limit
+func (u *Uploader) SetMaxPolling(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.maxPolling = d
+}
+
+// SetWriteTimeout changes how long a newly created replay may take to be
+// written completely before it fails with ErrIncomplete
+func (u *Uploader) SetWriteTimeout(d time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.writeTimeout = d
+}
+
+// SetRules changes the rules deciding which replays are uploaded, checked
+// for any uploads started afterwards; an empty set uploads every replay
+func (u *Uploader) SetRules(set rules.Set) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.filters = set
+}
+
+// Evaluate decides whether the upload rules allow a replay to be uploaded,
+// reading its metadata only when there are rules to check
+func (u *Uploader) Evaluate(replayFilename string) (rules.Decision, error) {
+	u.mu.RLock()
+	filters := u.filters
+	u.mu.RUnlock()
+
+	if len(filters) == 0 {
+		return rules.Decision{Upload: true}, nil
+	}
+
+	replay, err := sc2replay.Open(replayFilename)
+	if err != nil {
+		return rules.Decision{Upload: true}, err
+	}
+
+	return filters.Evaluate(replay, sc2utils.ToonFromPath(replayFilename)), nil
+}
+
+// Subscribe registers fn to be called with every Event emitted; fn is called
+// from the goroutine handling the replay and must not block
+func (u *Uploader) Subscribe(fn func(Event)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.subscribers = append(u.subscribers, fn)
+}
+
+// Handle waits for a newly created replay to have been written completely,
+// then uploads it once a worker is free, waiting without taking one; it
+// returns once the replay is done or ctx is cancelled, in which case the
+// upload is resumed by Resume later
+func (u *Uploader) Handle(ctx context.Context, replayFilename string) Event {
+	return <-u.enqueue(ctx, replayFilename, false, true)
+}
+
+// Enqueue hands a newly created replay to Handle, without waiting for it to
+// be done
+func (u *Uploader) Enqueue(ctx context.Context, replayFilename string) {
+	u.enqueue(ctx, replayFilename, false, true)
+}
+
+// Upload sends an existing replay once a worker is free, without waiting for
+// it to be written; it returns once the replay is done or ctx cancelled
+func (u *Uploader) Upload(ctx context.Context, replayFilename string, force bool) Event {
+	return <-u.enqueue(ctx, replayFilename, force, false)
+}
+
+// EnqueueUpload hands an existing replay to Upload, without waiting for it
+// to be done, returning the channel its last event is sent on
+func (u *Uploader) EnqueueUpload(ctx context.Context, replayFilename string, force bool) <-chan Event {
+	return u.enqueue(ctx, replayFilename, force, false)
+}
+
+// Wait blocks until every replay queued, including resumed uploads, is done,
+// which happens soon after their context was cancelled
+func (u *Uploader) Wait() {
+	u.wg.Wait()
+}
+
+// Check returns what Upload would do with a replay, without uploading it:
+// an EventSkipped or EventExcluded, or an EventQueued if it would be sent,
+// with Reason explaining why; nothing is emitted to subscribers
+func (u *Uploader) Check(replayFilename string, force bool) Event {
+	ev := Event{Type: EventFailed, Filename: replayFilename}
+
+	if rec, err := u.lookup(replayFilename); err != nil {
+		ev.Err = fmt.Errorf("failed to check ledger: %v", err)
+	} else {
+		ev, _ = u.check(rec, force)
+	}
+
+	ev.Time = time.Now()
+	_, ev.MapName, _ = utils.SplitFilepath(ev.Filename)
+
+	return ev
+}
+
+// Resume hands replays whose upload was interrupted, for example by the
+// program exiting or crashing, back to EnqueueUpload, as they were written
+// already; those sent already are not sent again, only followed until
+// sc2replaystats processed them
+func (u *Uploader) Resume(ctx context.Context) {
+	if u.ledger == nil {
+		return
+	}
+
+	entries, err := u.ledger.List()
+	if err != nil {
+		golog.Errorf("failed to resume uploads: %v", err)
+		return
+	}
+
+	for _, e := range entries {
+		if !e.Unfinished() {
+			continue
+		}
+
+		if _, err := os.Stat(e.Filename); err != nil {
+			golog.Warnf("cannot resume upload, replay is missing: %v", e.Filename)
+			continue
+		}
+
+		golog.Infof("Resuming interrupted upload: %v", e.Filename)
+		u.EnqueueUpload(ctx, e.Filename, false)
+	}
+}
+
+// Missed returns the replays in dirs which were saved while nothing watched
+// them, oldest first: those modified after the newest replay the ledger
+// recorded (rather than the one recorded last, which may be an old replay
+// uploaded by hand), and no longer ago than lookback, which the ledger does
+// not know of; with nothing recorded yet, every replay saved within lookback
+// is missed, while without a ledger there is no telling which replays were
+// uploaded before, so none are
+func (u *Uploader) Missed(dirs []string, lookback time.Duration) ([]string, error) {
+	if u.ledger == nil {
+		return nil, nil
+	}
+
+	entries, err := u.ledger.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var newest time.Time
+
+	for _, e := range entries {
+		modified := e.Modified
+		if modified.IsZero() {
+			modified = e.Created // recorded before Modified was
+		}
+
+		if modified.After(newest) {
+			newest = modified
+		}
+	}
+
+	since := time.Now().Add(-lookback)
+	if newest.After(since) {
+		since = newest
+	}
+
+	type replayFile struct {
+		Path    string
+		ModTime time.Time
+	}
+
+	found := make([]replayFile, 0)
+
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			golog.Warnf("failed to look for missed replays: %v: %v", dir, err)
+			continue
+		}
+
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ReplayExt) || !f.ModTime().After(since) {
+				continue
+			}
+
+			name := filepath.Join(dir, f.Name())
+
+			hash, err := ledger.HashFile(name)
+			if err != nil {
+				continue // removed meanwhile
+			}
+
+			if rec, err := u.ledger.Get(hash); err != nil {
+				return nil, err
+			} else if rec == nil {
+				found = append(found, replayFile{name, f.ModTime()})
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].ModTime.Before(found[j].ModTime)
+	})
+
+	missed := make([]string, len(found))
+	for i, f := range found {
+		missed[i] = f.Path
+	}
+
+	return missed, nil
+}
+
+// upload sends a replay unless the ledger shows it was already uploaded (and
+// force is not set), then has it followed until sc2replaystats processed it;
+// when cancelled the ledger is left as is, so that Resume picks it up again
+func (u *Uploader) upload(j *job) {
+	ctx, replayFilename := j.ctx, j.filename
+
+	rec, err := u.lookup(replayFilename)
+	if err != nil {
+		u.finish(j, u.emit(Event{Type: EventFailed, Filename: replayFilename, Err: fmt.Errorf("failed to check ledger: %v", err)}))
+		return
+	}
+
+	if ev, ok := u.check(rec, j.force); !ok {
+		u.finish(j, u.emit(ev))
+		return
+	}
+
+	client := u.Client(replayFilename)
+	if client == nil {
+		err := fmt.Errorf("no API key for account %q", sc2utils.AccountFromPath(replayFilename))
+		u.finish(j, u.emit(Event{Type: EventFailed, Filename: replayFilename, Err: err}))
+
+		return
+	}
+
+	var size int64
+	if s, err := os.Stat(replayFilename); err == nil {
+		size = s.Size()
+	}
+
+	// sent before being interrupted, so only its processing is waited for,
+	// as sending it again would upload it twice
+	if rec.Status == ledger.StatusProcessing && rec.QueueID != "" && !j.force {
+		u.process(j, client, rec, size)
+		return
+	}
+
+	u.record(rec, ledger.StatusUploading, nil)
+	u.emit(Event{Type: EventUploading, Filename: replayFilename, Size: size})
+
+	rqid, err := client.UploadReplayProgress(ctx, replayFilename, u.progress(replayFilename, size))
+	if ctx.Err() != nil {
+		u.finish(j, u.emit(Event{Type: EventFailed, Filename: replayFilename, Size: size, Err: ctx.Err()}))
+		return
+	}
+
+	var dup *sc2replaystats.ErrDuplicate
+
+	if errors.As(err, &dup) {
+		rec.ReplayID = dup.ReplayID
+		u.record(rec, ledger.StatusDuplicate, nil)
+		u.finish(j, u.emit(Event{Type: EventDuplicate, Filename: replayFilename, ReplayID: dup.ReplayID, Size: size}))
+
+		return
+	}
+
+	if err != nil {
+		u.record(rec, ledger.StatusFailed, err)
+		u.finish(j, u.emit(Event{Type: EventFailed, Filename: replayFilename, Size: size, Err: err}))
+
+		return
+	}
+
+	rec.QueueID = rqid
+	u.record(rec, ledger.StatusProcessing, nil)
+	u.process(j, client, rec, size)
+}
+
+// process has a replay sent to sc2replaystats followed until it was
+// processed
+func (u *Uploader) process(j *job, client *sc2replaystats.Client, rec *ledger.Entry, size int64) {
+	u.emit(Event{Type: EventProcessing, Filename: j.filename, QueueID: rec.QueueID, Size: size})
+
+	u.follow(&pending{
+		job:      j,
+		client:   client,
+		rec:      rec,
+		resolved: make(chan struct{}),
+		size:     size,
+		started:  time.Now(),
+	})
+}
+
+// progress returns a ProgressFunc emitting EventProgress for a replay being
+// uploaded, at most every progressInterval besides once it was sent entirely
+func (u *Uploader) progress(replayFilename string, size int64) sc2replaystats.ProgressFunc {
+	var last time.Time
+
+	return func(sent, total int64) {
+		if sent < total && time.Since(last) < progressInterval {
+			return
+		}
+
+		last = time.Now()
+		u.emit(Event{Type: EventProgress, Filename: replayFilename, Size: size, Sent: sent, Total: total})
+	}
+}
+
+// check decides whether a replay is to be uploaded, returning the event
+// explaining why and whether the upload should go ahead
+func (u *Uploader) check(rec *ledger.Entry, force bool) (Event, bool) {
+	ev := Event{Type: EventQueued, Filename: rec.Filename}
+
+	if rec.Done() && !force {
+		ev.Type, ev.QueueID, ev.ReplayID, ev.Reason = EventSkipped, rec.QueueID, rec.ReplayID, "already uploaded"
+		return ev, false
+	}
+
+	d, err := u.Evaluate(rec.Filename)
+	if err != nil {
+		golog.Warnf("cannot check upload rules, uploading anyway: %v: %v", rec.Filename, err)
+		ev.Reason = fmt.Sprintf("included, upload rules not checked: %v", err)
+		return ev, true
+	}
+
+	ev.Reason = d.String()
+	if !d.Upload {
+		ev.Type = EventExcluded
+	}
+
+	return ev, d.Upload
+}
+
+// claim marks a replay as being handled, returning false if it already was,
+// such as when it is both watched and found by Missed
+func (u *Uploader) claim(replayFilename string) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.active[replayFilename] {
+		return false
+	}
+
+	u.active[replayFilename] = true
+
+	return true
+}
+
+// release marks a replay claimed as no longer being handled
+func (u *Uploader) release(replayFilename string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	delete(u.active, replayFilename)
+}
+
+func (u *Uploader) emit(ev Event) Event {
+	ev.Time = time.Now()
+	_, ev.MapName, _ = utils.SplitFilepath(ev.Filename)
+
+	u.mu.RLock()
+	subscribers := u.subscribers
+	u.mu.RUnlock()
+
+	for _, fn := range subscribers {
+		fn(ev)
+	}
+
+	return ev
+}
+
+// lookup returns the ledger entry of a replay which has finished being
+// written, or a new entry if the replay was never seen before
+func (u *Uploader) lookup(replayFilename string) (*ledger.Entry, error) {
+	hash, err := ledger.HashFile(replayFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	var rec *ledger.Entry
+
+	if u.ledger != nil {
+		if rec, err = u.ledger.Get(hash); err != nil {
+			return nil, err
+		}
+	}
+
+	if rec == nil {
+		rec = &ledger.Entry{Hash: hash, Status: ledger.StatusPending}
+	}
+
+	rec.Filename = replayFilename
+
+	if s, err := os.Stat(replayFilename); err == nil {
+		rec.Modified = s.ModTime()
+	}
+
+	return rec, nil
+}
+
+// record saves the current state of a replay's upload to the ledger
+func (u *Uploader) record(rec *ledger.Entry, status ledger.Status, err error) {
+	rec.Status = status
+	rec.Error = ""
+
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	if u.ledger == nil {
+		return
+	}
+
+	if err := u.ledger.Put(rec); err != nil {
+		golog.Errorf("failed to record replay: %v: %v", rec.Filename, err)
+	}
+}
+
+// inFlight returns the EventSkipped of a replay which was already being
+// handled, which is not emitted, as the upload in-flight emits its own
+func inFlight(replayFilename string) Event {
+	ev := Event{Type: EventSkipped, Filename: replayFilename, Reason: "already being uploaded", Time: time.Now()}
+	_, ev.MapName, _ = utils.SplitFilepath(replayFilename)
+
+	return ev
+}
+
+// waitWritten waits for a newly created replay to have been written
+// completely, as a whole MPQ archive (see mpq.Archive.Complete), while it may
+// still be written to its BackupExt copy first, returning an error if ctx is
+// cancelled or it was not written in time
+func (u *Uploader) waitWritten(ctx context.Context, replayFilename string) error {
+	u.mu.RLock()
+	timeout := u.writeTimeout
+	u.mu.RUnlock()
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := complete(replayFilename)
+		if err == nil {
+			return nil
+		}
+
+		if os.IsNotExist(err) {
+			if _, backupErr := os.Stat(replayFilename + BackupExt); backupErr == nil {
+				err = fmt.Errorf("still written to %v", filepath.Base(replayFilename+BackupExt))
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%w within %v: %v", ErrIncomplete, timeout, err)
+		}
+
+		if err := sleep(ctx, writeCheckInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// complete returns an error unless a replay is a complete MPQ archive
+func complete(replayFilename string) error {
+	a, err := mpq.Open(replayFilename)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+
+	return a.Complete()
+}
+
+// sleep waits for the duration given, returning early with an error if ctx
+// is cancelled first
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
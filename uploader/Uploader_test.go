@@ -0,0 +1,443 @@
+package uploader_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/ledger"
+	"github.com/AlbinoGeek/sc2-rsu/rules"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats"
+	"github.com/AlbinoGeek/sc2-rsu/sc2replaystats/sc2replaystatstest"
+	"github.com/AlbinoGeek/sc2-rsu/uploader"
+)
+
+// newTestServer returns a fake sc2replaystats, which processes "new" replays,
+// reports "old" ones as duplicates, fails processing "bad" ones and fails to
+// receive "broken" ones
+func newTestServer() *sc2replaystatstest.Server {
+	srv := sc2replaystatstest.NewServer()
+	srv.Script("old.SC2Replay", sc2replaystatstest.Outcome{DuplicateOf: "200"})
+	srv.Script("bad.SC2Replay", sc2replaystatstest.Outcome{Fail: "could not parse replay"})
+	srv.Script("broken.SC2Replay", sc2replaystatstest.Outcome{Status: http.StatusInternalServerError})
+
+	return srv
+}
+
+func TestUploader(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	l, err := ledger.Open(filepath.Join(dir, "ledger.db"))
+	assert.Nil(t, err, "must not error")
+	defer l.Close()
+
+	u := uploader.New(srv.Client(), l)
+	u.PollInterval = time.Millisecond
+
+	events := make([]uploader.EventType, 0)
+	u.Subscribe(func(ev uploader.Event) {
+		if ev.Type != uploader.EventProgress {
+			events = append(events, ev.Type)
+		}
+	})
+
+	var cases = []struct {
+		Name     string
+		Force    bool
+		Result   uploader.EventType
+		ReplayID string
+		Events   []uploader.EventType
+	}{
+		{"new", false, uploader.EventSuccess, "1002", []uploader.EventType{uploader.EventQueued, uploader.EventUploading, uploader.EventProcessing, uploader.EventSuccess}},
+		{"new", false, uploader.EventSkipped, "1002", []uploader.EventType{uploader.EventQueued, uploader.EventSkipped}},
+		{"new", true, uploader.EventDuplicate, "1002", []uploader.EventType{uploader.EventQueued, uploader.EventUploading, uploader.EventProcessing, uploader.EventDuplicate}},
+		{"old", false, uploader.EventDuplicate, "200", []uploader.EventType{uploader.EventQueued, uploader.EventUploading, uploader.EventProcessing, uploader.EventDuplicate}},
+		{"bad", false, uploader.EventFailed, "", []uploader.EventType{uploader.EventQueued, uploader.EventUploading, uploader.EventProcessing, uploader.EventFailed}},
+		{"broken", false, uploader.EventFailed, "", []uploader.EventType{uploader.EventQueued, uploader.EventUploading, uploader.EventFailed}},
+	}
+
+	for _, c := range cases {
+		name := filepath.Join(dir, c.Name+".SC2Replay")
+		assert.Nil(t, ioutil.WriteFile(name, []byte(c.Name), 0644), "must not error")
+
+		events = events[:0]
+		ev := u.Upload(context.Background(), name, c.Force)
+
+		assert.Equal(t, c.Result, ev.Type, "result must match: %v", c.Name)
+		assert.Equal(t, c.ReplayID, ev.ReplayID, "replay ID must match: %v", c.Name)
+		assert.Equal(t, c.Events, events, "events must match: %v", c.Name)
+		assert.Equal(t, c.Result == uploader.EventFailed, ev.Err != nil, "only failures have errors: %v", c.Name)
+
+		hash, _ := ledger.HashFile(name)
+		rec, err := l.Get(hash)
+		assert.Nil(t, err, "must not error")
+		assert.NotNil(t, rec, "replay must be recorded: %v", c.Name)
+		assert.Equal(t, c.ReplayID, rec.ReplayID, "recorded replay ID must match: %v", c.Name)
+	}
+}
+
+func TestUploaderRules(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	u := uploader.New(srv.Client(), nil)
+	u.PollInterval = time.Millisecond
+	u.SetRules(rules.Set{{Name: "no-ai", Action: rules.ActionExclude, Mode: []string{"vs-ai"}}})
+
+	var cases = []struct {
+		Name   string
+		Sample string
+		Check  uploader.EventType
+		Result uploader.EventType
+	}{
+		{"new", "ladder-1v1", uploader.EventQueued, uploader.EventSuccess},
+		{"ai", "vs-ai-leave", uploader.EventExcluded, uploader.EventExcluded},
+		{"old", "", uploader.EventQueued, uploader.EventDuplicate}, // unreadable replays are uploaded anyway
+	}
+
+	dir := t.TempDir()
+	for _, c := range cases {
+		data := []byte(c.Name)
+		if c.Sample != "" {
+			var err error
+			data, err = ioutil.ReadFile(filepath.Join("..", "sc2replay", "testdata", c.Sample+".SC2Replay"))
+			assert.Nil(t, err, "must not error")
+		}
+
+		name := filepath.Join(dir, c.Name+".SC2Replay")
+		assert.Nil(t, ioutil.WriteFile(name, data, 0644), "must not error")
+
+		assert.Equal(t, c.Check, u.Check(name, false).Type, "check must match: %v", c.Name)
+
+		ev := u.Upload(context.Background(), name, false)
+		assert.Equal(t, c.Result, ev.Type, "result must match: %v", c.Name)
+		assert.Equal(t, c.Result == uploader.EventExcluded, strings.Contains(ev.Reason, "no-ai"), "reason must name the rule: %v", c.Name)
+	}
+}
+
+func TestUploaderProgress(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	srv.Script("slow.SC2Replay", sc2replaystatstest.Outcome{Polls: 3})
+
+	u := uploader.New(srv.Client(), nil)
+	u.PollInterval = time.Millisecond
+
+	var (
+		sent  []int64
+		polls []int
+		total int64
+	)
+
+	u.Subscribe(func(ev uploader.Event) {
+		if ev.Type != uploader.EventProgress {
+			return
+		}
+
+		assert.Equal(t, int64(4096), ev.Size, "progress must carry the replay size")
+
+		if ev.Polls > 0 {
+			polls = append(polls, ev.Polls)
+		} else {
+			sent = append(sent, ev.Sent)
+			total = ev.Total
+		}
+	})
+
+	name := filepath.Join(t.TempDir(), "slow.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(name, make([]byte, 4096), 0644), "must not error")
+
+	ev := u.Upload(context.Background(), name, false)
+	assert.Equal(t, uploader.EventSuccess, ev.Type, "upload must succeed")
+	assert.Equal(t, int64(4096), ev.Size, "result must carry the replay size")
+
+	assert.NotEmpty(t, sent, "upload progress must be reported")
+	assert.Greater(t, total, int64(4096), "total must include the form")
+	assert.Equal(t, total, sent[len(sent)-1], "last progress must be complete")
+	for i := 1; i < len(sent); i++ {
+		assert.Greater(t, sent[i], sent[i-1], "progress must only move forwards")
+	}
+	assert.Equal(t, []int{1, 2, 3}, polls, "every processing poll must be reported")
+}
+
+func TestUploaderAccounts(t *testing.T) {
+	shared, own := newTestServer(), newTestServer()
+	defer shared.Close()
+	defer own.Close()
+
+	u := uploader.New(shared.Client(), nil)
+	u.PollInterval = time.Millisecond
+	u.SetAccountClients(map[string]*sc2replaystats.Client{"222": own.Client()})
+
+	dir := t.TempDir()
+	for _, acc := range []string{"111", "222"} {
+		replays := filepath.Join(dir, "Accounts", acc, "1-S2-1-"+acc, "Replays", "Multiplayer")
+		assert.Nil(t, os.MkdirAll(replays, 0755), "must not error")
+
+		name := filepath.Join(replays, "new.SC2Replay")
+		assert.Nil(t, ioutil.WriteFile(name, []byte(acc), 0644), "must not error")
+
+		ev := u.Upload(context.Background(), name, false)
+		assert.Equal(t, uploader.EventSuccess, ev.Type, "upload must succeed: %v", acc)
+	}
+
+	assert.Len(t, shared.Uploads(), 1, "other accounts must use the shared client")
+	assert.Len(t, own.Uploads(), 1, "account must use its own client")
+
+	u.SetClient(nil)
+	ev := u.Upload(context.Background(), filepath.Join(dir, "Accounts", "111", "1-S2-1-111", "Replays", "Multiplayer", "new.SC2Replay"), true)
+	assert.Equal(t, uploader.EventFailed, ev.Type, "accounts without client must fail")
+	assert.Contains(t, ev.Err.Error(), `"111"`, "error must name the account")
+}
+
+func TestUploaderCancel(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	l, err := ledger.Open(filepath.Join(dir, "ledger.db"))
+	assert.Nil(t, err, "must not error")
+	defer l.Close()
+
+	u := uploader.New(srv.Client(), l)
+	u.PollInterval = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	u.Subscribe(func(ev uploader.Event) {
+		if ev.Type == uploader.EventProcessing {
+			cancel()
+		}
+	})
+
+	name := filepath.Join(dir, "new.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(name, []byte("new"), 0644), "must not error")
+
+	ev := u.Upload(ctx, name, false)
+	u.Wait()
+
+	assert.Equal(t, uploader.EventFailed, ev.Type, "cancelled uploads must fail")
+	assert.True(t, errors.Is(ev.Err, context.Canceled), "error must be the cancellation")
+
+	hash, _ := ledger.HashFile(name)
+	rec, err := l.Get(hash)
+	assert.Nil(t, err, "must not error")
+	assert.True(t, rec.Unfinished(), "cancelled uploads must be resumed later")
+
+	// resumed, the replay sent already is only followed
+	u = uploader.New(srv.Client(), l)
+	u.PollInterval = time.Millisecond
+
+	var events []uploader.EventType
+	u.Subscribe(func(ev uploader.Event) {
+		if ev.Type != uploader.EventProgress {
+			events = append(events, ev.Type)
+		}
+	})
+
+	u.Resume(context.Background())
+	u.Wait()
+
+	assert.Equal(t, []uploader.EventType{uploader.EventQueued, uploader.EventProcessing, uploader.EventSuccess}, events, "events must match")
+	assert.Len(t, srv.Uploads(), 1, "replays sent already must not be sent again")
+}
+
+func TestUploaderMissed(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	dir := t.TempDir()
+	l, err := ledger.Open(filepath.Join(dir, "ledger.db"))
+	assert.Nil(t, err, "must not error")
+	defer l.Close()
+
+	u := uploader.New(srv.Client(), l)
+	u.PollInterval = time.Millisecond
+
+	replays := filepath.Join(dir, "Multiplayer")
+	assert.Nil(t, os.Mkdir(replays, 0755), "must not error")
+
+	write := func(name string, modTime time.Time) string {
+		name = filepath.Join(replays, name)
+		assert.Nil(t, ioutil.WriteFile(name, []byte(name), 0644), "must not error")
+		assert.Nil(t, os.Chtimes(name, modTime, modTime), "must not error")
+
+		return name
+	}
+
+	now := time.Now()
+	ancient := write("ancient.SC2Replay", now.Add(-2*time.Hour))
+	before := write("before.SC2Replay", now.Add(-40*time.Minute))
+
+	missed, err := u.Missed([]string{replays}, time.Hour)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, []string{before}, missed, "replays within lookback must be missed before anything was recorded")
+
+	missed, err = u.Missed([]string{replays}, 0)
+	assert.Nil(t, err, "must not error")
+	assert.Empty(t, missed, "nothing must be missed without looking back")
+
+	assert.Equal(t, uploader.EventSuccess, u.Upload(context.Background(), write("new.SC2Replay", now.Add(-30*time.Minute)), false).Type, "must upload")
+
+	later := write("later.SC2Replay", now.Add(-15*time.Minute))
+	offline := write("offline.SC2Replay", now.Add(-20*time.Minute))
+	write("notes.txt", now.Add(-20*time.Minute))
+
+	// an old replay uploaded by hand, such as with "upload --since"
+	assert.Equal(t, uploader.EventSuccess, u.Upload(context.Background(), ancient, false).Type, "must upload")
+
+	missed, err = u.Missed([]string{replays, filepath.Join(dir, "missing")}, time.Hour)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, []string{offline, later}, missed, "only unknown replays saved since the newest recorded must be missed, oldest first")
+
+	missed, err = uploader.New(srv.Client(), nil).Missed([]string{replays}, time.Hour)
+	assert.Nil(t, err, "must not error")
+	assert.Empty(t, missed, "nothing must be missed without a ledger")
+}
+
+func TestUploaderWorkers(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+	srv.Script("stuck.SC2Replay", sc2replaystatstest.Outcome{Polls: 1000})
+
+	u := uploader.New(srv.Client(), nil)
+	u.PollInterval = time.Millisecond
+	u.SetMaxPolling(50 * time.Millisecond)
+	u.SetWorkers(1)
+
+	var (
+		mu        sync.Mutex
+		uploading int
+		most      int
+	)
+
+	u.Subscribe(func(ev uploader.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch ev.Type {
+		case uploader.EventUploading:
+			if uploading++; uploading > most {
+				most = uploading
+			}
+		case uploader.EventProcessing:
+			uploading--
+		}
+	})
+
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b", "c", "stuck"} {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".SC2Replay"), []byte(name), 0644), "must not error")
+	}
+
+	stuck := filepath.Join(dir, "stuck.SC2Replay")
+	u.EnqueueUpload(context.Background(), stuck, false)
+
+	for _, name := range []string{"a", "b", "c"} {
+		u.EnqueueUpload(context.Background(), filepath.Join(dir, name+".SC2Replay"), false)
+	}
+
+	ev := u.Upload(context.Background(), stuck, false)
+	assert.Equal(t, uploader.EventSkipped, ev.Type, "replays in-flight must not be queued twice")
+
+	u.Wait()
+	assert.Equal(t, 1, most, "only one replay must be uploaded at once")
+
+	ev = u.Upload(context.Background(), stuck, false)
+	assert.Equal(t, uploader.EventFailed, ev.Type, "replays processing for too long must fail")
+	assert.True(t, errors.Is(ev.Err, uploader.ErrStillProcessing), "error must say the replay is still processing")
+}
+
+func TestUploaderHandle(t *testing.T) {
+	srv := newTestServer()
+	defer srv.Close()
+
+	u := uploader.New(srv.Client(), nil)
+	u.PollInterval = time.Millisecond
+	u.SetWriteTimeout(2 * time.Second)
+
+	replay, err := ioutil.ReadFile(filepath.Join("..", "sc2replay", "testdata", "ladder-1v1.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+
+	other, err := ioutil.ReadFile(filepath.Join("..", "sc2replay", "testdata", "vs-ai-leave.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+
+	dir := t.TempDir()
+
+	// written in two parts, the first of which is no complete archive
+	name := filepath.Join(dir, "parts.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(name, replay[:len(replay)/2], 0644), "must not error")
+
+	go func(name string) {
+		time.Sleep(300 * time.Millisecond)
+		ioutil.WriteFile(name, replay, 0644)
+	}(name)
+
+	assert.Equal(t, uploader.EventSuccess, u.Handle(context.Background(), name).Type, "replays must be uploaded once written")
+
+	// written to a backup first, then renamed
+	name = filepath.Join(dir, "renamed.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(name+uploader.BackupExt, other, 0644), "must not error")
+
+	go func(name string) {
+		time.Sleep(300 * time.Millisecond)
+		os.Rename(name+uploader.BackupExt, name)
+	}(name)
+
+	assert.Equal(t, uploader.EventSuccess, u.Handle(context.Background(), name).Type, "replays must be uploaded once renamed")
+
+	// never finished
+	u.SetWriteTimeout(300 * time.Millisecond)
+
+	// ...unlike every sample replay, which must not be waited for when whole
+	samples, err := filepath.Glob(filepath.Join("..", "sc2replay", "testdata", "*.SC2Replay"))
+	assert.Nil(t, err, "must not error")
+
+	for _, sample := range samples {
+		data, err := ioutil.ReadFile(sample)
+		assert.Nil(t, err, "must not error")
+
+		name = filepath.Join(dir, "whole-"+filepath.Base(sample))
+		assert.Nil(t, ioutil.WriteFile(name, data, 0644), "must not error")
+		assert.NotEqual(t, uploader.EventFailed, u.Handle(context.Background(), name).Type, "whole replays must be uploaded: %v", sample)
+	}
+
+	name = filepath.Join(dir, "truncated.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(name, replay[:len(replay)-1], 0644), "must not error")
+
+	ev := u.Handle(context.Background(), name)
+	assert.Equal(t, uploader.EventFailed, ev.Type, "incomplete replays must fail")
+	assert.True(t, errors.Is(ev.Err, uploader.ErrIncomplete), "error must say the replay is incomplete")
+
+	// waiting for a replay to be written must not keep others from uploading
+	u.SetWorkers(1)
+	u.SetWriteTimeout(time.Minute)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	waiting := make(chan uploader.Event, 1)
+
+	go func() { waiting <- u.Handle(ctx, name) }()
+
+	fresh := filepath.Join(dir, "fresh.SC2Replay")
+	assert.Nil(t, ioutil.WriteFile(fresh, []byte(fresh), 0644), "must not error")
+	assert.Equal(t, uploader.EventSuccess, u.Upload(context.Background(), fresh, false).Type, "must upload while another replay is being written")
+
+	select {
+	case <-waiting:
+		t.Fatal("incomplete replays must still be waited for")
+	default:
+	}
+
+	cancel()
+	assert.Equal(t, uploader.EventFailed, (<-waiting).Type, "cancelled waits must fail")
+}
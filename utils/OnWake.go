@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// OnWake calls fn each time the computer resumes from sleep, with about how
+// long it slept, until ctx is cancelled; waking is told apart by the wall
+// clock having moved on by more than twice interval between two ticks of
+// interval, as tickers do not count the time spent asleep
+func OnWake(ctx context.Context, interval time.Duration, fn func(slept time.Duration)) {
+	OnWakeClock(ctx, interval, wallClock, fn)
+}
+
+// OnWakeClock is OnWake, reading the wall clock with now
+func OnWakeClock(ctx context.Context, interval time.Duration, now func() time.Time, fn func(slept time.Duration)) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	last := now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			now := now()
+
+			if gap := now.Sub(last); gap > 2*interval {
+				fn(gap - interval)
+			}
+
+			last = now
+		}
+	}
+}
+
+// wallClock returns the current time without its monotonic clock reading,
+// which does not count the time spent asleep either
+func wallClock() time.Time {
+	return time.Now().Round(0)
+}
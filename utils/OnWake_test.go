@@ -0,0 +1,58 @@
+package utils_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/utils"
+)
+
+func TestOnWake(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	woke := false
+	utils.OnWake(ctx, 50*time.Millisecond, func(time.Duration) {
+		woke = true
+	})
+
+	assert.NotNil(t, ctx.Err(), "must return once cancelled")
+	assert.False(t, woke, "must not wake without sleeping")
+}
+
+func TestOnWakeClock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// a clock moving on by the interval each tick, but by an hour on the
+	// third, as if the computer slept meanwhile
+	var (
+		clock = time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+		reads int
+	)
+
+	now := func() time.Time {
+		if reads++; reads == 5 {
+			cancel()
+		}
+
+		if reads == 3 {
+			clock = clock.Add(time.Hour)
+		} else {
+			clock = clock.Add(time.Millisecond)
+		}
+
+		return clock
+	}
+
+	var slept []time.Duration
+
+	utils.OnWakeClock(ctx, time.Millisecond, now, func(d time.Duration) {
+		slept = append(slept, d)
+	})
+
+	assert.Equal(t, []time.Duration{time.Hour - time.Millisecond}, slept, "must wake once, having slept about an hour")
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// WritePidFile writes the ID of this process to the file at path, refusing
+// to replace one naming another process which is still running, and returns
+// a func removing the file again
+func WritePidFile(path string) (remove func() error, err error) {
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid != os.Getpid() && running(pid) {
+			return nil, fmt.Errorf("already running as process %d (see %v)", pid, path)
+		}
+	}
+
+	if err = ioutil.WriteFile(path, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write pidfile: %v", err)
+	}
+
+	return func() error {
+		return os.Remove(path)
+	}, nil
+}
+
+// running returns whether a process exists, as far as can be told
+func running(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	return p.Signal(syscall.Signal(0)) == nil
+}
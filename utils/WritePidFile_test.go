@@ -0,0 +1,38 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/AlbinoGeek/sc2-rsu/utils"
+)
+
+func TestWritePidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.pid")
+
+	remove, err := utils.WritePidFile(path)
+	assert.Nil(t, err, "must not error")
+
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err, "must not error")
+	assert.Equal(t, strconv.Itoa(os.Getpid())+"\n", string(data), "must contain our process ID")
+
+	assert.Nil(t, remove(), "must not error")
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "must be removed")
+
+	// a stale pidfile, left behind by a process which is gone
+	assert.Nil(t, ioutil.WriteFile(path, []byte("999999999\n"), 0644), "must not error")
+	_, err = utils.WritePidFile(path)
+	assert.Nil(t, err, "stale pidfiles must be replaced")
+
+	// another process which is running
+	assert.Nil(t, ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0644), "must not error")
+	_, err = utils.WritePidFile(path)
+	assert.NotNil(t, err, "running processes must not be replaced")
+}